@@ -0,0 +1,272 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// sniffLength is how many bytes of a document are inspected for a meta charset, per the html5 spec
+const sniffLength = 1024
+
+var (
+	metaCharsetRegexp = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.-]+)`)
+	xmlEncodingRegexp = regexp.MustCompile(`(?i)^\s*<\?xml[^>]+encoding\s*=\s*["']([a-z0-9_:.-]+)`)
+
+	// aliases for charsets that browsers treat as windows-1252
+	encodingAliases = map[string]string{
+		"ascii":     "windows1252",
+		"usascii":   "windows1252",
+		"latin1":    "windows1252",
+		"iso88591":  "windows1252",
+		"l1":        "windows1252",
+		"cp819":     "windows1252",
+		"isolatin1": "windows1252",
+	}
+)
+
+func normalizeEncodingName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// lookupEncoding returns the encoding for a charset name, or nil if the charset is utf-8
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	normalized := normalizeEncodingName(name)
+
+	switch normalized {
+	case "", "utf8":
+		return nil, nil
+	}
+
+	if alias, ok := encodingAliases[normalized]; ok {
+		normalized = alias
+	} else if strings.HasPrefix(normalized, "cp125") {
+		normalized = "windows" + strings.TrimPrefix(normalized, "cp")
+	}
+
+	for _, enc := range charmap.All {
+		if normalizeEncodingName(fmt.Sprintf("%v", enc)) == normalized {
+			return enc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unknown encoding %q", name)
+}
+
+func isTextualContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+xml"), strings.HasSuffix(mediaType, "+json"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/xml", "application/json", "application/javascript":
+		return true
+	}
+
+	return false
+}
+
+// detectCharset finds the charset of a response from the Content-Type header, a meta tag or an xml declaration
+func detectCharset(contentType string, body []byte) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if charset, ok := params["charset"]; ok {
+			return charset
+		}
+	}
+
+	head := body
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+
+	if m := xmlEncodingRegexp.FindSubmatch(head); len(m) > 1 {
+		return string(m[1])
+	}
+
+	if m := metaCharsetRegexp.FindSubmatch(head); len(m) > 1 {
+		return string(m[1])
+	}
+
+	return ""
+}
+
+// charsetTransport transcodes textual responses to utf-8 before they are parsed
+type charsetTransport struct {
+	http.RoundTripper
+	Encoding string
+	Logger   logrus.FieldLogger
+
+	mu          sync.RWMutex
+	passthrough bool
+}
+
+// SetPassthrough stops responses being transcoded, so that downloads served with a textual
+// content type reach the caller unchanged
+func (t *charsetTransport) SetPassthrough(passthrough bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.passthrough = passthrough
+}
+
+func (t *charsetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	t.mu.RLock()
+	passthrough := t.passthrough
+	t.mu.RUnlock()
+
+	contentType := resp.Header.Get("Content-Type")
+	if passthrough || !isTextualContentType(contentType) {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	charset := t.Encoding
+	if charset == "" {
+		charset = detectCharset(contentType, body)
+	}
+
+	enc, err := lookupEncoding(charset)
+	if err != nil {
+		t.Logger.
+			WithFields(logrus.Fields{"charset": charset, "url": req.URL.String()}).
+			Warn("Unknown charset in response, leaving body as-is")
+	} else if enc != nil {
+		decoded, err := enc.NewDecoder().Bytes(body)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode %s response: %v", charset, err)
+		}
+		body = decoded
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+
+	return resp, nil
+}
+
+// encodeString converts a utf-8 string into the given encoding, replacing unsupported characters
+func encodeString(enc encoding.Encoding, s string) (string, error) {
+	if enc == nil {
+		return s, nil
+	}
+	return encoding.ReplaceUnsupported(enc.NewEncoder()).String(s)
+}
+
+// encodeValues converts the keys and values of url values into the given encoding
+func encodeValues(enc encoding.Encoding, vals url.Values) (url.Values, error) {
+	if enc == nil {
+		return vals, nil
+	}
+
+	encoded := url.Values{}
+	for key, values := range vals {
+		encodedKey, err := encodeString(enc, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, val := range values {
+			encodedVal, err := encodeString(enc, val)
+			if err != nil {
+				return nil, err
+			}
+			encoded.Add(encodedKey, encodedVal)
+		}
+	}
+
+	return encoded, nil
+}
+
+// encodeURL converts the path and query of a url into the given encoding, so that keywords that
+// are templated into a search path are escaped as the site expects. Only the path and the query
+// parts that contain non-ascii text are changed, the rest of the url is left as it was written
+func encodeURL(enc encoding.Encoding, rawURL string) (string, error) {
+	if enc == nil {
+		return rawURL, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if !isASCII(u.Path) {
+		if u.Path, err = encodeString(enc, u.Path); err != nil {
+			return "", err
+		}
+		u.RawPath = ""
+	}
+
+	if u.RawQuery != "" {
+		if u.RawQuery, err = encodeRawQuery(enc, u.RawQuery); err != nil {
+			return "", err
+		}
+	}
+
+	return u.String(), nil
+}
+
+// encodeRawQuery converts the keys and values of a query string that contain non-ascii text into
+// the given encoding, keeping the order and escaping of the rest of the query
+func encodeRawQuery(enc encoding.Encoding, rawQuery string) (string, error) {
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		parts := strings.SplitN(param, "=", 2)
+		for j, part := range parts {
+			unescaped, err := url.QueryUnescape(part)
+			if err != nil || isASCII(unescaped) {
+				continue
+			}
+			encoded, err := encodeString(enc, unescaped)
+			if err != nil {
+				return "", err
+			}
+			parts[j] = url.QueryEscape(encoded)
+		}
+		params[i] = strings.Join(parts, "=")
+	}
+	return strings.Join(params, "&"), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cardigann/cardigann/logger"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestLookupEncoding(t *testing.T) {
+	for idx, example := range []struct {
+		name     string
+		expected string
+	}{
+		{"", ""},
+		{"UTF-8", ""},
+		{"windows-1252", "Windows 1252"},
+		{"Windows-1251", "Windows 1251"},
+		{"cp1250", "Windows 1250"},
+		{"ISO-8859-1", "Windows 1252"},
+		{"iso-8859-15", "ISO 8859-15"},
+		{"KOI8-R", "KOI8-R"},
+	} {
+		enc, err := lookupEncoding(example.name)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		var result string
+		if enc != nil {
+			result = enc.(interface {
+				String() string
+			}).String()
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+
+	if _, err := lookupEncoding("llamas-1"); err == nil {
+		t.Fatal("Expected an error for an unknown encoding")
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	for idx, example := range []struct {
+		contentType, body, expected string
+	}{
+		{"text/html; charset=windows-1252", "", "windows-1252"},
+		{"text/html", `<html><head><meta charset="iso-8859-15"></head></html>`, "iso-8859-15"},
+		{"text/html", `<meta http-equiv="Content-Type" content="text/html; charset=windows-1251">`, "windows-1251"},
+		{"text/html; charset=utf-8", `<meta charset="iso-8859-15">`, "utf-8"},
+		{"application/rss+xml", `<?xml version="1.0" encoding="ISO-8859-1"?><rss></rss>`, "ISO-8859-1"},
+		{"text/html", `<html></html>`, ""},
+	} {
+		result := detectCharset(example.contentType, []byte(example.body))
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
+
+func TestCharsetTransport(t *testing.T) {
+	mock := httpmock.NewMockTransport()
+	transport := &charsetTransport{RoundTripper: mock, Logger: logger.Logger}
+
+	mock.RegisterResponder("GET", "http://example.org/header", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewBytesResponse(http.StatusOK, []byte("Caf\xe9"))
+		resp.Header.Set("Content-Type", "text/html; charset=windows-1252")
+		return resp, nil
+	})
+
+	mock.RegisterResponder("GET", "http://example.org/meta", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewBytesResponse(http.StatusOK, []byte("<meta charset=\"windows-1252\">Caf\xe9"))
+		resp.Header.Set("Content-Type", "text/html")
+		return resp, nil
+	})
+
+	mock.RegisterResponder("GET", "http://example.org/file.torrent", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewBytesResponse(http.StatusOK, []byte("d8:announce\xe9e"))
+		resp.Header.Set("Content-Type", "application/x-bittorrent")
+		return resp, nil
+	})
+
+	for idx, example := range []struct {
+		url, expected string
+	}{
+		{"http://example.org/header", "Café"},
+		{"http://example.org/meta", `<meta charset="windows-1252">Café`},
+		{"http://example.org/file.torrent", "d8:announce\xe9e"},
+	} {
+		req, _ := http.NewRequest("GET", example.url, nil)
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, body)
+		}
+	}
+}
+
+func TestEncodeValues(t *testing.T) {
+	enc, err := lookupEncoding("windows-1252")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vals, err := encodeValues(enc, url.Values{"search": []string{"Amélie"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if encoded := vals.Encode(); encoded != "search=Am%E9lie" {
+		t.Fatalf("Expected values to be encoded as windows-1252, got %q", encoded)
+	}
+}
+
+func TestEncodeURL(t *testing.T) {
+	enc, err := lookupEncoding("windows-1252")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, example := range []struct {
+		url, expected string
+	}{
+		{"https://example.org/search/Amélie", "https://example.org/search/Am%E9lie"},
+		{"https://example.org/search/Am%C3%A9lie", "https://example.org/search/Am%E9lie"},
+		{"https://example.org/search.php?q=Am%C3%A9lie", "https://example.org/search.php?q=Am%E9lie"},
+		{"https://example.org/search.php?q=llamas", "https://example.org/search.php?q=llamas"},
+		{"https://example.org/search.php?q=Am%C3%A9lie&freeleech&cat[]=1&a=b", "https://example.org/search.php?q=Am%E9lie&freeleech&cat[]=1&a=b"},
+		{"https://example.org/search.php?z=1&freeleech&c%5B%5D=2", "https://example.org/search.php?z=1&freeleech&c%5B%5D=2"},
+		{"https://example.org/search/Am%C3%A9lie?page=2&q", "https://example.org/search/Am%E9lie?page=2&q"},
+	} {
+		encoded, err := encodeURL(enc, example.url)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if encoded != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, encoded)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var (
+	strftimeDirectives = map[byte]string{
+		'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03", 'M': "04",
+		'S': "05", 'p': "PM", 'b': "Jan", 'h': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+		'z': "-0700", 'Z': "MST", 'j': "002", 'f': "000000", '%': "%",
+	}
+
+	// strftime directives with a - flag aren't zero padded
+	strftimeUnpadded = map[byte]string{
+		'm': "1", 'd': "2", 'I': "3", 'H': "15", 'M': "4", 'S': "5",
+	}
+
+	// moment tokens, longest first so that MMMM is matched before MM
+	momentTokens = []struct{ token, layout string }{
+		{"YYYY", "2006"}, {"YY", "06"}, {"MMMM", "January"}, {"MMM", "Jan"}, {"MM", "01"},
+		{"M", "1"}, {"dddd", "Monday"}, {"ddd", "Mon"}, {"DDDD", "002"}, {"DD", "02"}, {"D", "2"},
+		{"HH", "15"}, {"H", "15"}, {"hh", "03"}, {"h", "3"}, {"mm", "04"}, {"m", "4"},
+		{"ss", "05"}, {"s", "5"}, {"SSS", "000"}, {"A", "PM"}, {"a", "pm"}, {"ZZ", "-0700"},
+		{"Z", "-07:00"}, {"z", "MST"},
+	}
+
+	momentLayoutRegexp = regexp.MustCompile(`YY|DD|HH|hh|mm|ss`)
+)
+
+// goDateLayout converts a strftime (%Y-%m-%d) or moment (YYYY-MM-DD) style layout into a go
+// reference layout, go layouts are returned unchanged
+func goDateLayout(layout string) string {
+	if strings.Contains(layout, "%") {
+		return strftimeLayout(layout)
+	} else if momentLayoutRegexp.MatchString(layout) {
+		return momentLayout(layout)
+	}
+	return layout
+}
+
+func strftimeLayout(layout string) string {
+	var b bytes.Buffer
+
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i == len(layout)-1 {
+			b.WriteByte(layout[i])
+			continue
+		}
+
+		directives := strftimeDirectives
+		if layout[i+1] == '-' && i+2 < len(layout) {
+			directives = strftimeUnpadded
+			i++
+		}
+
+		if l, ok := directives[layout[i+1]]; ok {
+			b.WriteString(l)
+		} else {
+			b.WriteString(layout[i : i+2])
+		}
+		i++
+	}
+
+	return b.String()
+}
+
+func momentLayout(layout string) string {
+	var b bytes.Buffer
+
+	for i := 0; i < len(layout); {
+		// text in square brackets is escaped
+		if layout[i] == '[' {
+			if end := strings.IndexByte(layout[i:], ']'); end != -1 {
+				b.WriteString(layout[i+1 : i+end])
+				i += end + 1
+				continue
+			}
+		}
+
+		matched := false
+		for _, t := range momentTokens {
+			if strings.HasPrefix(layout[i:], t.token) {
+				b.WriteString(t.layout)
+				i += len(t.token)
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			b.WriteByte(layout[i])
+			i++
+		}
+	}
+
+	return b.String()
+}
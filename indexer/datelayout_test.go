@@ -0,0 +1,22 @@
+package indexer
+
+import "testing"
+
+func TestGoDateLayout(t *testing.T) {
+	for idx, example := range []struct {
+		layout, expected string
+	}{
+		{"2006-01-02 15:04", "2006-01-02 15:04"},
+		{"Mon, 02 Jan 2006 15:04:05 MST", "Mon, 02 Jan 2006 15:04:05 MST"},
+		{"%Y-%m-%d %H:%M:%S", "2006-01-02 15:04:05"},
+		{"%-d %b %Y, %-I:%M %p", "2 Jan 2006, 3:04 PM"},
+		{"%A %e %B %y 100%%", "Monday _2 January 06 100%"},
+		{"YYYY-MM-DD HH:mm:ss", "2006-01-02 15:04:05"},
+		{"D MMMM YYYY [at] h:mm A", "2 January 2006 at 3:04 PM"},
+		{"ddd, DD MMM YY HH:mm ZZ", "Mon, 02 Jan 06 15:04 -0700"},
+	} {
+		if result := goDateLayout(example.layout); result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package indexer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/headzoo/surf/browser"
+	"github.com/headzoo/surf/jar"
+)
+
+const (
+	defaultDetailsConcurrency = 2
+	defaultDetailsLimit       = 20
+)
+
+// detailsBlock extracts extra fields from the details page of each result, pages are fetched
+// for the first limit results with at most concurrency requests at a time
+type detailsBlock struct {
+	Fields      fieldsListBlock `yaml:"fields"`
+	Concurrency int             `yaml:"concurrency"`
+	Limit       int             `yaml:"limit"`
+}
+
+func (d *detailsBlock) IsEmpty() bool {
+	return len(d.Fields) == 0
+}
+
+func (d *detailsBlock) concurrency() int {
+	if d.Concurrency <= 0 {
+		return defaultDetailsConcurrency
+	}
+	return d.Concurrency
+}
+
+func (d *detailsBlock) limit() int {
+	if d.Limit <= 0 {
+		return defaultDetailsLimit
+	}
+	return d.Limit
+}
+
+// enrichFromDetails fetches the details page of items and merges the fields extracted from them
+// into the items. Items whose details page fails are logged and returned unchanged
+func (r *Runner) enrichFromDetails(items []extractedItem, templateCtx searchTemplateCtx) {
+	details := r.definition.Search.Details
+
+	// details pages are linked from the search page
+	var referer string
+	if u := r.browser.Url(); u != nil {
+		referer = u.String()
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, details.concurrency())
+
+	for idx := range items {
+		if idx >= details.limit() {
+			break
+		}
+		if items[idx].DetailsURL == "" {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := r.enrichItem(r.detailsTab(referer), &items[idx], idx+1, templateCtx); err != nil {
+				r.logger.
+					WithFields(logrus.Fields{"row": idx + 1, "details": items[idx].DetailsURL}).
+					Warnf("Failed to extract fields from details page: %v", err)
+			}
+		}(idx)
+	}
+
+	wg.Wait()
+}
+
+// detailsTab returns a tab of the runner's browser for fetching a details page concurrently with
+// others, it shares the browser's transport, cookies and user agent but has its own history
+func (r *Runner) detailsTab(referer string) browser.Browsable {
+	tab := r.browser.NewTab()
+	tab.SetHistoryJar(jar.NewMemoryHistory())
+	if referer != "" {
+		tab.SetHeadersJar(http.Header{"Referer": []string{referer}})
+	}
+	return tab
+}
+
+func (r *Runner) enrichItem(tab browser.Browsable, item *extractedItem, rowIdx int, templateCtx searchTemplateCtx) error {
+	detailsURL, err := url.Parse(item.DetailsURL)
+	if err != nil {
+		return err
+	}
+
+	if err = tab.Open(detailsURL.String()); err != nil {
+		return err
+	}
+
+	if tab.StatusCode() != http.StatusOK {
+		return fmt.Errorf("Details page returned status %d", tab.StatusCode())
+	}
+
+	ctx := fieldTemplateCtx{
+		Config: templateCtx.Config,
+		Query:  templateCtx.Query,
+		Result: map[string]string{},
+	}
+
+	row, err := r.extractFields(rowIdx, htmlRow{tab.Dom()}, r.definition.Search.Details.Fields, ctx)
+	if err != nil {
+		return err
+	}
+
+	r.logger.
+		WithFields(logrus.Fields{"row": rowIdx, "data": row}).
+		Debugf("Finished details page for row %d", rowIdx)
+
+	resolve := func(s string) (string, error) {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", err
+		}
+		return detailsURL.ResolveReference(u).String(), nil
+	}
+
+	for key, val := range row {
+		r.setItemField(item, rowIdx, key, val, resolve)
+	}
+
+	r.completeItem(item)
+	return nil
+}
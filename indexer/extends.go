@@ -0,0 +1,105 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// sourceFunc returns the raw yaml source of a definition by key
+type sourceFunc func(key string) ([]byte, error)
+
+// isBaseDefinition returns whether a key is a base definition, bases start with an underscore
+// and can be extended and loaded, but aren't listed as indexers
+func isBaseDefinition(key string) bool {
+	return strings.HasPrefix(key, "_")
+}
+
+// resolveExtends merges the definition in src over the chain of definitions that it extends.
+// Maps are merged recursively so a definition only needs to set the keys it overrides, any other
+// value (including lists) replaces the value in the base definition
+func resolveExtends(key string, src []byte, source sourceFunc) ([]byte, error) {
+	doc, err := resolveExtendsChain(key, src, source, []string{})
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return src, nil
+	}
+	return yaml.Marshal(doc)
+}
+
+func resolveExtendsChain(key string, src []byte, source sourceFunc, chain []string) (yaml.MapSlice, error) {
+	for _, seen := range chain {
+		if seen == key {
+			return nil, fmt.Errorf("Definition %s has a cycle in extends: %s -> %s",
+				chain[0], strings.Join(chain, " -> "), key)
+		}
+	}
+	chain = append(chain, key)
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+
+	var base string
+	for _, item := range doc {
+		if item.Key == "extends" {
+			base, _ = item.Value.(string)
+		}
+	}
+
+	if base == "" {
+		if len(chain) == 1 {
+			return nil, nil
+		}
+		return doc, nil
+	}
+
+	baseSrc, err := source(base)
+	if err == ErrUnknownIndexer {
+		return nil, fmt.Errorf("Definition %s extends unknown definition %s", key, base)
+	} else if err != nil {
+		return nil, err
+	}
+
+	baseDoc, err := resolveExtendsChain(base, baseSrc, source, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeYAML(baseDoc, doc), nil
+}
+
+// mergeYAML returns base with the keys in override merged over it, nested maps are merged
+func mergeYAML(base, override yaml.MapSlice) yaml.MapSlice {
+	result := append(yaml.MapSlice{}, base...)
+
+	for _, item := range override {
+		idx := -1
+		for i := range result {
+			if result[i].Key == item.Key {
+				idx = i
+				break
+			}
+		}
+
+		if idx == -1 {
+			result = append(result, item)
+			continue
+		}
+
+		baseMap, baseIsMap := result[idx].Value.(yaml.MapSlice)
+		overrideMap, overrideIsMap := item.Value.(yaml.MapSlice)
+
+		if baseIsMap && overrideIsMap {
+			result[idx].Value = mergeYAML(baseMap, overrideMap)
+		} else {
+			result[idx].Value = item.Value
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,173 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var exampleExtendsSources = map[string]string{
+	"_engine": `
+---
+  language: en-us
+  login:
+    path: /login.php
+    method: post
+    inputs:
+      username: "{{ .Config.username }}"
+      password: "{{ .Config.password }}"
+    test:
+      path: /index.php
+  search:
+    path: /browse.php
+    rows:
+      selector: table.torrents tr
+    fields:
+      title:
+        selector: a.title
+      size:
+        selector: td.size
+`,
+	"_engine_v2": `
+---
+  extends: _engine
+  search:
+    path: /torrents.php
+`,
+	"example": `
+---
+  site: example
+  name: Example
+  extends: _engine_v2
+  links:
+    - https://example.org/
+  login:
+    inputs:
+      username: "{{ .Config.email }}"
+  search:
+    fields:
+      size:
+        selector: td:nth-child(5)
+      seeders:
+        selector: td.seeders
+`,
+	"cycle_a": `
+---
+  site: cycle_a
+  extends: cycle_b
+`,
+	"cycle_b": `
+---
+  extends: cycle_a
+`,
+	"orphan": `
+---
+  site: orphan
+  extends: _missing
+`,
+}
+
+func exampleExtendsSource(key string) ([]byte, error) {
+	src, ok := exampleExtendsSources[key]
+	if !ok {
+		return nil, ErrUnknownIndexer
+	}
+	return []byte(src), nil
+}
+
+func TestResolveExtends(t *testing.T) {
+	src, err := resolveExtends("example", []byte(exampleExtendsSources["example"]), exampleExtendsSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := ParseDefinition(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Site != "example" || def.Extends != "_engine_v2" {
+		t.Fatalf("Unexpected site %q or extends %q", def.Site, def.Extends)
+	}
+
+	if def.Login.Path != "/login.php" || def.Login.Method != "post" || def.Login.Test.Path != "/index.php" {
+		t.Fatalf("Login block wasn't inherited: %#v", def.Login)
+	}
+
+	if expected := (inputsBlock{
+		"username": "{{ .Config.email }}",
+		"password": "{{ .Config.password }}",
+	}); !reflect.DeepEqual(def.Login.Inputs, expected) {
+		t.Fatalf("Expected login inputs %v, got %v", expected, def.Login.Inputs)
+	}
+
+	if def.Search.Path != "/torrents.php" || def.Search.Rows.Selector != "table.torrents tr" {
+		t.Fatalf("Search block wasn't inherited: %#v", def.Search)
+	}
+
+	fields := []string{}
+	for _, f := range def.Search.Fields {
+		fields = append(fields, f.Field+"="+f.Block.Selector)
+	}
+
+	if expected := "title=a.title,size=td:nth-child(5),seeders=td.seeders"; strings.Join(fields, ",") != expected {
+		t.Fatalf("Expected fields %s, got %s", expected, strings.Join(fields, ","))
+	}
+}
+
+func TestResolveExtendsErrors(t *testing.T) {
+	for idx, example := range []struct {
+		key, expected string
+	}{
+		{"cycle_a", "Definition cycle_a has a cycle in extends: cycle_a -> cycle_b -> cycle_a"},
+		{"orphan", "Definition orphan extends unknown definition _missing"},
+	} {
+		_, err := resolveExtends(example.key, []byte(exampleExtendsSources[example.key]), exampleExtendsSource)
+		if err == nil || err.Error() != example.expected {
+			t.Fatalf("Row #%d expected error %q, got %v", idx+1, example.expected, err)
+		}
+	}
+}
+
+func TestFsLoaderHidesBaseDefinitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cardigann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, key := range []string{"_engine", "_engine_v2", "example"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, key+".yml"), []byte(exampleExtendsSources[key]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := &fsLoader{[]string{dir}}
+
+	keys, err := loader.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+
+	if !reflect.DeepEqual(keys, []string{"example"}) {
+		t.Fatalf("Expected only example to be listed, got %v", keys)
+	}
+
+	def, err := loader.Load("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Search.Path != "/torrents.php" {
+		t.Fatalf("Expected inherited search path, got %q", def.Search.Path)
+	}
+
+	if _, err = loader.Load("_engine"); err != nil {
+		t.Fatalf("Expected base definition to be loadable, got %v", err)
+	}
+}
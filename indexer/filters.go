@@ -3,6 +3,7 @@ package indexer
 import (
 	"errors"
 	"fmt"
+	"html"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/bcampbell/fuzzytime"
 	"github.com/cardigann/cardigann/logger"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
@@ -24,79 +26,360 @@ var (
 	filterLogger = logger.Logger
 )
 
-func invokeFilter(name string, args interface{}, value string) (string, error) {
-	switch name {
-	case "querystring":
+// filterFunc applies a filter to a value, name is the name the filter was invoked with, dates
+// without a time zone are parsed in loc and numbers are parsed with the numbers format
+type filterFunc func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error)
+
+// filters are the filters that definitions can use, keyed by name
+var filters = map[string]filterFunc{
+	"querystring": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
 		param, ok := args.(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument", name)
+			return "", argsErrorf("Filter %q requires a string argument", name)
 		}
 		return filterQueryString(param, value)
-
-	case "timeparse", "dateparse":
-		if args == nil {
-			return filterDateParse(nil, value)
-		}
-		if layout, ok := args.(string); ok {
-			return filterDateParse([]string{layout}, value)
-		}
-		return "", fmt.Errorf("Filter argument type %T was invalid", args)
-
-	case "regexp":
+	},
+	"dateparse": invokeDateParse,
+	"timeparse": invokeDateParse,
+	"regexp": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
 		pattern, ok := args.(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument", name)
+			return "", argsErrorf("Filter %q requires a string argument", name)
 		}
 		return filterRegexp(pattern, value)
-
-	case "split":
-		sep, ok := (args.([]interface{}))[0].(string)
+	},
+	"split": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		argsList, ok := args.([]interface{})
+		if !ok || len(argsList) != 2 {
+			return "", argsErrorf("Filter %q requires a separator and a position", name)
+		}
+		sep, ok := argsList[0].(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
+			return "", argsErrorf("Filter %q requires a string argument at idx 0", name)
 		}
-		pos, ok := (args.([]interface{}))[1].(int)
+		pos, ok := argsList[1].(int)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires an int argument at idx 1", name)
+			return "", argsErrorf("Filter %q requires an int argument at idx 1", name)
 		}
 		return filterSplit(sep, pos, value)
-
-	case "replace":
-		from, ok := (args.([]interface{}))[0].(string)
+	},
+	"replace": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		argsList, ok := args.([]interface{})
+		if !ok || len(argsList) != 2 {
+			return "", argsErrorf("Filter %q requires a string to replace and a replacement", name)
+		}
+		from, ok := argsList[0].(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
+			return "", argsErrorf("Filter %q requires a string argument at idx 0", name)
 		}
-		to, ok := (args.([]interface{}))[1].(string)
+		to, ok := argsList[1].(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument at idx 1", name)
+			return "", argsErrorf("Filter %q requires a string argument at idx 1", name)
 		}
 		return strings.Replace(value, from, to, -1), nil
-
-	case "trim":
+	},
+	"trim": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
 		cutset, ok := args.(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
+			return "", argsErrorf("Filter %q requires a string argument at idx 0", name)
 		}
 		return strings.Trim(value, cutset), nil
-
-	case "append":
+	},
+	"append": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
 		str, ok := args.(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
+			return "", argsErrorf("Filter %q requires a string argument at idx 0", name)
 		}
 		return value + str, nil
-
-	case "prepend":
+	},
+	"prepend": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
 		str, ok := args.(string)
 		if !ok {
-			return "", fmt.Errorf("Filter %q requires a string argument at idx 0", name)
+			return "", argsErrorf("Filter %q requires a string argument at idx 0", name)
 		}
 		return str + value, nil
+	},
+	"timeago":   invokeFuzzyTime,
+	"fuzzytime": invokeFuzzyTime,
+	"reltime":   invokeFuzzyTime,
+	"diacritics": withoutArgs(func(value string) (string, error) {
+		return filterDiacritics(value), nil
+	}),
+	"nopunctuation": withoutArgs(func(value string) (string, error) {
+		return filterNoPunctuation(value), nil
+	}),
+	"episodeformat": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		format, ok := args.(string)
+		if !ok {
+			return "", argsErrorf("Filter %q requires a string argument", name)
+		}
+		return filterEpisodeFormat(format, value), nil
+	},
+	"tolower": withoutArgs(func(value string) (string, error) {
+		return strings.ToLower(value), nil
+	}),
+	"toupper": withoutArgs(func(value string) (string, error) {
+		return strings.ToUpper(value), nil
+	}),
+	"urlencode": withoutArgs(func(value string) (string, error) {
+		return url.QueryEscape(value), nil
+	}),
+	"urldecode": withoutArgs(url.QueryUnescape),
+	"htmldecode": withoutArgs(func(value string) (string, error) {
+		return html.UnescapeString(value), nil
+	}),
+	"validfilename": withoutArgs(func(value string) (string, error) {
+		return filterValidFilename(value), nil
+	}),
+	"fuzzysize": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		if args != nil {
+			return "", argsErrorf("Filter %q doesn't take any arguments", name)
+		}
+		return filterFuzzySize(value, numbers)
+	},
+	"re_replace": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		argsList, ok := args.([]interface{})
+		if !ok || len(argsList) != 2 {
+			return "", argsErrorf("Filter %q requires a pattern and a replacement", name)
+		}
+		pattern, ok := argsList[0].(string)
+		if !ok {
+			return "", argsErrorf("Filter %q requires a string argument at idx 0", name)
+		}
+		replacement, ok := argsList[1].(string)
+		if !ok {
+			return "", argsErrorf("Filter %q requires a string argument at idx 1", name)
+		}
+		return filterReReplace(pattern, replacement, value)
+	},
+	"scriptvariable": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		variable, ok := args.(string)
+		if !ok {
+			return "", argsErrorf("Filter %q requires a string argument", name)
+		}
+		return filterScriptVariable(variable, value)
+	},
+	"strdump": func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		label, ok := args.(string)
+		if args != nil && !ok {
+			return "", argsErrorf("Filter %q takes an optional string argument", name)
+		}
+		filterLogger.
+			WithFields(logrus.Fields{"label": label, "value": value}).
+			Info("Dumping value from strdump filter")
+		return value, nil
+	},
+}
+
+// filterArgsError is returned when a filter is invoked with arguments it can't use, these are
+// reported by the linter as well as when filters are applied
+type filterArgsError string
+
+func (e filterArgsError) Error() string {
+	return string(e)
+}
+
+func argsErrorf(format string, a ...interface{}) error {
+	return filterArgsError(fmt.Sprintf(format, a...))
+}
+
+// withoutArgs wraps a filter that doesn't take any arguments
+func withoutArgs(f func(value string) (string, error)) filterFunc {
+	return func(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+		if args != nil {
+			return "", argsErrorf("Filter %q doesn't take any arguments", name)
+		}
+		return f(value)
+	}
+}
+
+func invokeDateParse(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+	if args == nil {
+		return filterDateParse(nil, value, loc)
+	}
+	if layout, ok := args.(string); ok {
+		return filterDateParse([]string{layout}, value, loc)
+	}
+	if list, ok := args.([]interface{}); ok {
+		layouts := []string{}
+		for idx, arg := range list {
+			layout, ok := arg.(string)
+			if !ok {
+				return "", argsErrorf("Filter %q requires a string argument at idx %d", name, idx)
+			}
+			layouts = append(layouts, layout)
+		}
+		return filterDateParse(layouts, value, loc)
+	}
+	return "", argsErrorf("Filter argument type %T was invalid", args)
+}
+
+func invokeFuzzyTime(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+	return filterFuzzyTime(value, time.Now(), loc)
+}
+
+func invokeFilter(name string, args interface{}, value string) (string, error) {
+	return invokeFilterWithLocale(name, args, value, time.UTC, englishNumbers)
+}
+
+// invokeFilterWithLocale invokes a filter, dates without a time zone are parsed in loc and
+// numbers are parsed with the numbers format
+func invokeFilterWithLocale(name string, args interface{}, value string, loc *time.Location, numbers numberFormat) (string, error) {
+	f, ok := filters[name]
+	if !ok {
+		return "", errors.New("Unknown filter " + name)
+	}
+	return f(name, args, value, loc, numbers)
+}
+
+var (
+	// letters that don't decompose into a base letter and a combining mark
+	diacriticsReplacer = strings.NewReplacer(
+		"ß", "ss", "æ", "ae", "Æ", "AE", "ø", "o", "Ø", "O", "œ", "oe", "Œ", "OE",
+		"đ", "d", "Đ", "D", "ł", "l", "Ł", "L", "þ", "th", "Þ", "TH",
+	)
+
+	episodeRegexp = regexp.MustCompile(`(?i)\bS(\d{1,2})E(\d{1,3})\b`)
+)
+
+// filterDiacritics replaces accented letters with their unaccented equivalent
+func filterDiacritics(value string) string {
+	decomposed := norm.NFD.String(diacriticsReplacer.Replace(value))
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, decomposed)
+}
+
+// filterNoPunctuation replaces punctuation with spaces and collapses whitespace
+func filterNoPunctuation(value string) string {
+	return strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, value)), " ")
+}
+
+// filterEpisodeFormat rewrites S01E02 style episodes with a format that is passed the season
+// and episode numbers, an empty format removes the episode
+func filterEpisodeFormat(format string, value string) string {
+	out := episodeRegexp.ReplaceAllStringFunc(value, func(m string) string {
+		parts := episodeRegexp.FindStringSubmatch(m)
+		season, _ := strconv.Atoi(parts[1])
+		episode, _ := strconv.Atoi(parts[2])
+		if format == "" {
+			return ""
+		}
+		return fmt.Sprintf(format, season, episode)
+	})
+	return strings.Join(strings.Fields(out), " ")
+}
+
+// filterValidFilename replaces characters that aren't allowed in filenames with underscores
+func filterValidFilename(value string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, value))
+}
+
+func filterReReplace(pattern, replacement, value string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(value, replacement), nil
+}
+
+var (
+	fuzzySizeRegexp = regexp.MustCompile(`(?i)(\d[\d.,\s]*)\s*([kmgtp]?i?)(b|o|bytes?|octets?)\b`)
+)
+
+// filterFuzzySize finds a size like "1,5 Go" or "1.234,56MiB" in a string and normalizes
+// it to something like "1.5 GB" that can be parsed as a size
+func filterFuzzySize(value string, numbers numberFormat) (string, error) {
+	m := fuzzySizeRegexp.FindStringSubmatch(value)
+	if m == nil {
+		return "", fmt.Errorf("No size found in %q", value)
+	}
+
+	number := normalizeNumber(m[1], numbers)
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("Failed to parse size %q: %v", m[0], err)
+	}
 
-	case "timeago", "fuzzytime", "reltime":
-		return filterFuzzyTime(value, time.Now())
+	prefix := strings.ToUpper(m[2])
+	if strings.HasSuffix(prefix, "I") {
+		prefix = strings.TrimSuffix(prefix, "I") + "i"
 	}
 
-	return "", errors.New("Unknown filter " + name)
+	return fmt.Sprintf("%s %sB", number, prefix), nil
+}
+
+// filterScriptVariable extracts the value assigned to a javascript variable like
+// `var torrents = [...];`, arrays and objects end at their closing bracket and other values end at
+// a semicolon or the end of the line
+func filterScriptVariable(variable string, value string) (string, error) {
+	re, err := regexp.Compile(`(?:^|[^\w$])` + regexp.QuoteMeta(variable) + `\s*=\s*`)
+	if err != nil {
+		return "", err
+	}
+
+	// comparisons like torrents == x aren't assignments
+	start := -1
+	for _, loc := range re.FindAllStringIndex(value, -1) {
+		if !strings.HasPrefix(value[loc[1]:], "=") {
+			start = loc[1]
+			break
+		}
+	}
+	if start == -1 {
+		return "", fmt.Errorf("No assignment to variable %q found", variable)
+	}
+
+	rest := value[start:]
+	if rest == "" || (rest[0] != '[' && rest[0] != '{') {
+		if end := strings.IndexAny(rest, ";\n"); end != -1 {
+			rest = rest[:end]
+		}
+		return strings.Trim(strings.TrimSpace(rest), `"'`), nil
+	}
+
+	var depth int
+	var quote byte
+	var escaped bool
+
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		if quote != 0 {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case '[', '{':
+			depth++
+		case ']', '}':
+			if depth--; depth == 0 {
+				return rest[:i+1], nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("Value of variable %q isn't terminated", variable)
 }
 
 func filterQueryString(param string, value string) (string, error) {
@@ -107,9 +390,11 @@ func filterQueryString(param string, value string) (string, error) {
 	return u.Query().Get(param), nil
 }
 
-func filterDateParse(layouts []string, value string) (string, error) {
+// filterDateParse parses a date with the first of the layouts that matches, layouts can be go
+// reference layouts or strftime or moment style layouts
+func filterDateParse(layouts []string, value string, loc *time.Location) (string, error) {
 	for _, layout := range layouts {
-		if t, err := time.Parse(layout, value); err == nil {
+		if t, err := time.ParseInLocation(goDateLayout(layout), value, loc); err == nil {
 			return t.Format(filterTimeFormat), nil
 		}
 	}
@@ -121,6 +406,9 @@ func filterSplit(sep string, pos int, value string) (string, error) {
 	if pos < 0 {
 		pos = len(frags) + pos
 	}
+	if pos < 0 || pos >= len(frags) {
+		return "", fmt.Errorf("Split position %d is out of range", pos)
+	}
 	return frags[pos], nil
 }
 
@@ -172,18 +460,6 @@ var (
 	missingYearRegexp = regexp.MustCompile(`^\d{1,2}-\d{1,2}\b`)
 )
 
-func normalizeNumber(s string) string {
-	normalized := normalizeSpace(s)
-	normalized = strings.Trim(s, "-")
-	normalized = strings.Replace(s, ",", "", -1)
-
-	if normalized == "" {
-		normalized = "0"
-	}
-
-	return normalized
-}
-
 func normalizeSpace(s string) string {
 	return strings.TrimSpace(strings.Map(func(r rune) rune {
 		if unicode.IsSpace(r) {
@@ -266,7 +542,8 @@ func parseTimeAgo(src string, now time.Time) (time.Time, error) {
 	return now, nil
 }
 
-func parseFuzzyTime(src string, now time.Time) (time.Time, error) {
+// parseFuzzyTime parses a date in any format, dates without a time zone are in loc
+func parseFuzzyTime(src string, now time.Time, loc *time.Location) (time.Time, error) {
 	if timeAgoRegexp.MatchString(src) {
 		t, err := parseTimeAgo(src, now)
 		if err != nil {
@@ -275,6 +552,8 @@ func parseFuzzyTime(src string, now time.Time) (time.Time, error) {
 		return t, nil
 	}
 
+	// today and yesterday are relative to the date where the site is
+	now = now.In(loc)
 	normalized := normalizeSpace(src)
 
 	out := todayRegexp.ReplaceAllLiteralString(normalized, now.Format("Mon, 02 Jan 2006 "))
@@ -304,14 +583,14 @@ func parseFuzzyTime(src string, now time.Time) (time.Time, error) {
 	}
 
 	if !dt.HasTZOffset() {
-		dt.Time.SetTZOffset(0)
+		return time.ParseInLocation("2006-01-02T15:04:05", dt.ISOFormat(), loc)
 	}
 
 	return time.Parse("2006-01-02T15:04:05Z07:00", dt.ISOFormat())
 }
 
-func filterFuzzyTime(src string, now time.Time) (string, error) {
-	t, err := parseFuzzyTime(src, now)
+func filterFuzzyTime(src string, now time.Time, loc *time.Location) (string, error) {
+	t, err := parseFuzzyTime(src, now, loc)
 	if err != nil {
 		return "", fmt.Errorf("error parsing fuzzy time %q: %v", src, err)
 	}
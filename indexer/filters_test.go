@@ -28,7 +28,7 @@ func TestDateParseFilter(t *testing.T) {
 	for idx, example := range []struct{ strTime, format, expected string }{
 		{now.Format("Mon Jan 2 15:04:05 MST 2006"), "Mon Jan 2 15:04:05 MST 2006", now.Format(filterTimeFormat)},
 	} {
-		result, err := filterDateParse([]string{example.format}, example.strTime)
+		result, err := filterDateParse([]string{example.format}, example.strTime, time.UTC)
 		if err != nil {
 			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
 		}
@@ -56,7 +56,7 @@ func TestFuzzyTimeFilter(t *testing.T) {
 		{"06-01-2009 19:39", time.Date(2009, time.June, 01, 19, 39, 0, 0, time.UTC)},
 		{"06-01-09 19:39", time.Date(2009, time.June, 01, 19, 39, 0, 0, time.UTC)},
 	} {
-		result, err := filterFuzzyTime(example.pattern, now)
+		result, err := filterFuzzyTime(example.pattern, now, time.UTC)
 		if err != nil {
 			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
 		}
@@ -90,3 +90,186 @@ func TestParseTimeAgo(t *testing.T) {
 		}
 	}
 }
+
+func TestKeywordsFilters(t *testing.T) {
+	for idx, example := range []struct {
+		name            string
+		args            interface{}
+		value, expected string
+	}{
+		{"diacritics", nil, "Amélie Poulain Señor Straße", "Amelie Poulain Senor Strasse"},
+		{"diacritics", nil, "Søren Kierkegaard", "Soren Kierkegaard"},
+		{"nopunctuation", nil, "Marvel's Agents of S.H.I.E.L.D.", "Marvel s Agents of S H I E L D"},
+		{"nopunctuation", nil, "  Llama:  the   movie! ", "Llama the movie"},
+		{"episodeformat", "%dx%02d", "Llama Llama S01E02", "Llama Llama 1x02"},
+		{"episodeformat", "S%02dE%02d", "Llama s1e2", "Llama S01E02"},
+		{"episodeformat", "", "Llama Llama S01E02 720p", "Llama Llama 720p"},
+		{"episodeformat", "%dx%02d", "Llama Llama S01", "Llama Llama S01"},
+	} {
+		result, err := invokeFilter(example.name, example.args, example.value)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+
+	if _, err := invokeFilter("episodeformat", nil, "Llama S01E01"); err == nil {
+		t.Fatal("Expected an error for episodeformat without a format")
+	}
+}
+
+func TestStringFilters(t *testing.T) {
+	for idx, example := range []struct {
+		name     string
+		args     interface{}
+		value    string
+		expected string
+	}{
+		{"tolower", nil, "Llama LLAMA", "llama llama"},
+		{"toupper", nil, "Llama llama", "LLAMA LLAMA"},
+		{"urlencode", nil, "llamas & alpacas", "llamas+%26+alpacas"},
+		{"urldecode", nil, "llamas+%26+alpacas", "llamas & alpacas"},
+		{"htmldecode", nil, "Llamas &amp; Alpacas &#8211; S01", "Llamas & Alpacas – S01"},
+		{"re_replace", []interface{}{`S(\d+)E(\d+)`, "${1}x${2}"}, "Llamas S01E02", "Llamas 01x02"},
+		{"re_replace", []interface{}{`\s+`, " "}, "Llamas   and\tAlpacas", "Llamas and Alpacas"},
+		{"validfilename", nil, `Llamas: "The Movie" 1/2?`, "Llamas_ _The Movie_ 1_2_"},
+		{"strdump", nil, "llamas", "llamas"},
+		{"strdump", "title", "llamas", "llamas"},
+		{"fuzzysize", nil, "1,5 Go", "1.5 GB"},
+		{"fuzzysize", nil, "Size: 1.234,56MiB", "1234.56 MiB"},
+		{"fuzzysize", nil, "1,234.5 MB", "1234.5 MB"},
+		{"fuzzysize", nil, "1,234 kb", "1234 KB"},
+		{"fuzzysize", nil, "4.7GB", "4.7 GB"},
+		{"fuzzysize", nil, "512 bytes", "512 B"},
+		{"scriptvariable", "torrents", `var torrents = [{"name": "a]b"}, {"name": "c"}];`, `[{"name": "a]b"}, {"name": "c"}]`},
+		{"scriptvariable", "data", "var page = 1;\nwindow.data = {\"rows\": [1, 2]};", `{"rows": [1, 2]}`},
+		{"scriptvariable", "total", "var mytotal = 1; if (total == 0) {}; var total = \"42\";", "42"},
+	} {
+		result, err := invokeFilter(example.name, example.args, example.value)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
+
+func TestStringFiltersInvalidArgs(t *testing.T) {
+	for idx, example := range []struct {
+		name  string
+		args  interface{}
+		value string
+	}{
+		{"tolower", "llamas", "llamas"},
+		{"urlencode", []interface{}{"a"}, "llamas"},
+		{"urldecode", nil, "%zz"},
+		{"re_replace", "llamas", "llamas"},
+		{"re_replace", []interface{}{"a"}, "llamas"},
+		{"re_replace", []interface{}{"(", "b"}, "llamas"},
+		{"re_replace", []interface{}{"a", 1}, "llamas"},
+		{"strdump", 1, "llamas"},
+		{"fuzzysize", nil, "llamas"},
+		{"fuzzysize", "GB", "1 GB"},
+		{"diacritics", "llamas", "Llamás"},
+		{"nopunctuation", []interface{}{" "}, "llamas!"},
+		{"split", "/", "llamas/alpacas"},
+		{"split", []interface{}{"/", 2}, "llamas/alpacas"},
+		{"scriptvariable", nil, "var torrents = [];"},
+		{"scriptvariable", "torrents", "var results = [];"},
+		{"scriptvariable", "torrents", "var torrents = [{"},
+	} {
+		if _, err := invokeFilter(example.name, example.args, example.value); err == nil {
+			t.Fatalf("Row #%d expected an error", idx+1)
+		}
+	}
+}
+
+func TestFuzzySizeFilterNumberFormat(t *testing.T) {
+	for idx, example := range []struct {
+		value    string
+		numbers  numberFormat
+		expected string
+	}{
+		{"1,234 Go", europeanNumbers, "1.234 GB"},
+		{"1,234 Go", englishNumbers, "1234 GB"},
+		{"1.234 Mo", europeanNumbers, "1234 MB"},
+		{"1.234 MB", englishNumbers, "1.234 MB"},
+		{"1.234,5 Mo", englishNumbers, "1234.5 MB"},
+	} {
+		result, err := invokeFilterWithLocale("fuzzysize", nil, example.value, time.UTC, example.numbers)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
+
+func TestDateParseFilterLayouts(t *testing.T) {
+	cet, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("No time zone database available")
+	}
+
+	for idx, example := range []struct {
+		args     interface{}
+		value    string
+		loc      *time.Location
+		expected time.Time
+	}{
+		{"2006-01-02 15:04", "2009-11-10 23:00", time.UTC, time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)},
+		{"%d/%m/%Y %H:%M", "10/11/2009 23:00", time.UTC, time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)},
+		{"DD.MM.YYYY HH:mm", "10.11.2009 23:00", time.UTC, time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)},
+		{"DD.MM.YYYY HH:mm", "10.11.2009 23:00", cet, time.Date(2009, 11, 10, 22, 0, 0, 0, time.UTC)},
+		{"DD.MM.YYYY HH:mm", "10.07.2009 23:00", cet, time.Date(2009, 7, 10, 21, 0, 0, 0, time.UTC)},
+		{"%Y-%m-%d %H:%M %z", "2009-11-10 23:00 +0100", time.UTC, time.Date(2009, 11, 10, 22, 0, 0, 0, time.UTC)},
+		{[]interface{}{"%Y-%m-%d", "MMM D, YYYY"}, "Nov 10, 2009", time.UTC, time.Date(2009, 11, 10, 0, 0, 0, 0, time.UTC)},
+	} {
+		result, err := invokeFilterWithLocale("dateparse", example.args, example.value, example.loc, englishNumbers)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		parsed, err := time.Parse(filterTimeFormat, result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !parsed.Equal(example.expected) {
+			t.Fatalf("Row #%d was expecting %s, got %s", idx+1, example.expected, parsed)
+		}
+	}
+
+	if _, err := invokeFilter("dateparse", []interface{}{"%Y", 1}, "2009"); err == nil {
+		t.Fatal("Expected an error for a non-string layout")
+	}
+}
+
+func TestParseFuzzyTimeLocation(t *testing.T) {
+	cet, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("No time zone database available")
+	}
+
+	now := time.Date(2009, time.November, 10, 23, 30, 0, 0, time.UTC)
+
+	for idx, example := range []struct {
+		value    string
+		expected time.Time
+	}{
+		{"2009-11-10 20:00", time.Date(2009, 11, 10, 19, 0, 0, 0, time.UTC)},
+		{"2009-11-10 20:00 +0000", time.Date(2009, 11, 10, 20, 0, 0, 0, time.UTC)},
+		{"Today 00:15", time.Date(2009, 11, 10, 23, 15, 0, 0, time.UTC)},
+		{"3 mins ago", now.Add(time.Minute * -3)},
+	} {
+		result, err := parseFuzzyTime(example.value, now, cet)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if !result.Equal(example.expected) {
+			t.Fatalf("Row #%d was expecting %s, got %s", idx+1, example.expected, result)
+		}
+	}
+}
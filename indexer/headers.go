@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// headerTransport adds headers and query parameters to every request made to an indexer, this
+// is how header and apikey logins authenticate and how headers blocks are sent
+type headerTransport struct {
+	http.RoundTripper
+
+	// Hosts restricts which hosts are sent the headers and query, so that credentials aren't
+	// leaked to third parties on redirects. An empty map allows all hosts
+	Hosts map[string]bool
+
+	mu      sync.RWMutex
+	headers http.Header
+	query   url.Values
+}
+
+// SetHeader sets a header that is sent on all subsequent requests
+func (t *headerTransport) SetHeader(name, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.headers == nil {
+		t.headers = http.Header{}
+	}
+	t.headers.Set(name, value)
+}
+
+// SetQuery sets a query parameter that is sent on all subsequent requests
+func (t *headerTransport) SetQuery(name, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.query == nil {
+		t.query = url.Values{}
+	}
+	t.query.Set(name, value)
+}
+
+func (t *headerTransport) allowed(u *url.URL) bool {
+	if len(t.Hosts) == 0 {
+		return true
+	}
+	return t.Hosts[strings.ToLower(urlHostname(u))]
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if (len(t.headers) == 0 && len(t.query) == 0) || !t.allowed(req.URL) {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	// a RoundTripper mustn't modify the request it's given
+	r := new(http.Request)
+	*r = *req
+
+	r.Header = http.Header{}
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	for k, v := range t.headers {
+		r.Header[k] = append([]string(nil), v...)
+	}
+
+	if len(t.query) > 0 {
+		u := *req.URL
+		q := u.Query()
+		for k, v := range t.query {
+			q[k] = append([]string(nil), v...)
+		}
+		u.RawQuery = q.Encode()
+		r.URL = &u
+	}
+
+	return t.RoundTripper.RoundTrip(r)
+}
+
+// hostsForLinks returns the set of hostnames for a list of urls
+func hostsForLinks(links ...string) map[string]bool {
+	hosts := map[string]bool{}
+	for _, link := range links {
+		if u, err := url.Parse(link); err == nil && u.Host != "" {
+			hosts[strings.ToLower(urlHostname(u))] = true
+		}
+	}
+	return hosts
+}
+
+// urlHostname returns the host of a url without any port, like url.URL.Hostname in go 1.8
+func urlHostname(u *url.URL) string {
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(u.Host, "["), "]")
+}
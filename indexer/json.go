@@ -0,0 +1,188 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// splitJSONPath splits a path like `data.torrents[0].name` into its keys
+func splitJSONPath(path string) []string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	keys := []string{}
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// jsonPath returns the value at a path in a decoded json document
+func jsonPath(v interface{}, path string) (interface{}, bool) {
+	for _, key := range splitJSONPath(path) {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			val, ok := t[key]
+			if !ok {
+				return nil, false
+			}
+			v = val
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, false
+			}
+			if idx < 0 {
+				idx = len(t) + idx
+			}
+			if idx < 0 || idx >= len(t) {
+				return nil, false
+			}
+			v = t[idx]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonText converts a decoded json value into the string that filters operate on
+func jsonText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(t)
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// MatchJSON is the equivalent of MatchText for a decoded json value, selectors are json paths
+func (s *selectorBlock) MatchJSON(from interface{}) (string, error) {
+	return s.fallback(s.matchJSON(from))
+}
+
+func (s *selectorBlock) matchJSON(from interface{}) (string, error) {
+	if s.TextVal != "" {
+		return s.TextVal, nil
+	}
+
+	val := from
+	if selectors := s.selectorList(); len(selectors) > 0 {
+		var ok bool
+		for _, sel := range selectors {
+			if val, ok = jsonPath(from, sel); ok {
+				break
+			}
+		}
+		if !ok && len(selectors) == 1 {
+			return "", noMatchError(fmt.Sprintf("Failed to match selector %q", selectors[0]))
+		} else if !ok {
+			return "", noMatchError(fmt.Sprintf("Failed to match any of selectors %q", selectors))
+		}
+	}
+
+	if s.Attribute != "" {
+		var ok bool
+		if val, ok = jsonPath(val, s.Attribute); !ok {
+			return "", noMatchError(fmt.Sprintf("Requested attribute %q doesn't exist", s.Attribute))
+		}
+	}
+
+	output := jsonText(val)
+
+	if len(s.Case) > 0 {
+		filterLogger.
+			WithFields(logrus.Fields{"case": s.Case}).
+			Debugf("Applying case to value")
+		value, err := s.Case.match(func(pattern string) bool {
+			return pattern == output
+		})
+		if err != nil {
+			return "", err
+		}
+		return s.applyFilters(value)
+	}
+
+	return s.applyFilters(output)
+}
+
+type jsonRow struct {
+	value interface{}
+}
+
+func (r jsonRow) MatchText(block selectorBlock) (string, error) {
+	return block.MatchJSON(r.value)
+}
+
+func (r jsonRow) Text() string {
+	return jsonText(r.value)
+}
+
+func (r jsonRow) Clone() searchRow {
+	return r
+}
+
+// parseJSONDocument decodes a json document, keeping numbers in their original format
+func parseJSONDocument(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse json response: %v", err)
+	}
+
+	return doc, nil
+}
+
+// parseJSONRows decodes a json document and returns the rows found at the rows selector. Arrays
+// are returned in order, objects are treated as a collection of rows keyed by id
+func parseJSONRows(body []byte, selector string) ([]searchRow, error) {
+	doc, err := parseJSONDocument(body)
+	if err != nil {
+		return nil, err
+	}
+
+	val, ok := jsonPath(doc, selector)
+	if !ok {
+		return []searchRow{}, nil
+	}
+
+	rows := []searchRow{}
+
+	switch t := val.(type) {
+	case nil:
+	case []interface{}:
+		for _, v := range t {
+			rows = append(rows, jsonRow{v})
+		}
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			rows = append(rows, jsonRow{t[k]})
+		}
+	default:
+		return nil, fmt.Errorf("Rows selector %q matched a %T, expected an array or object", selector, val)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,94 @@
+package indexer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const exampleJSONResponse = `{
+  "data": {
+    "torrents": [
+      {"id": 1, "name": "Llama llama S01E01", "size": 4294967296, "freeleech": true, "tags": ["tv", "hd"]},
+      {"id": 2, "name": " Llama llama S01E02 ", "size": 1024, "freeleech": false, "tags": null}
+    ]
+  }
+}`
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(exampleJSONResponse), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, example := range []struct {
+		path     string
+		expected string
+		ok       bool
+	}{
+		{"data.torrents[0].name", "Llama llama S01E01", true},
+		{"$.data.torrents.1.name", "Llama llama S01E02", true},
+		{"data.torrents[-1].freeleech", "false", true},
+		{"data.torrents[0].tags", `["tv","hd"]`, true},
+		{"data.torrents[1].tags", "", true},
+		{"data.torrents[2].name", "", false},
+		{"data.llamas", "", false},
+	} {
+		val, ok := jsonPath(doc, example.path)
+		if ok != example.ok {
+			t.Fatalf("Row #%d was expecting ok to be %v", idx+1, example.ok)
+		}
+		if result := jsonText(val); result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
+
+func TestParseJSONRows(t *testing.T) {
+	rows, err := parseJSONRows([]byte(exampleJSONResponse), "data.torrents")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	for idx, example := range []struct {
+		block    selectorBlock
+		expected string
+	}{
+		{selectorBlock{Selector: "name"}, "Llama llama S01E01"},
+		{selectorBlock{Selector: "size"}, "4294967296"},
+		{selectorBlock{Selector: "id", Filters: []filterBlock{{Name: "prepend", Args: "details.php?id="}}}, "details.php?id=1"},
+		{selectorBlock{Selector: "freeleech", Case: caseBlock{{"true", "0"}, {"false", "1"}}}, "0"},
+		{selectorBlock{TextVal: "llamas"}, "llamas"},
+		{selectorBlock{Selectors: []string{"title", "name"}}, "Llama llama S01E01"},
+		{selectorBlock{Selector: "grabs", Default: "0"}, "0"},
+		{selectorBlock{Selector: "grabs", Optional: true}, ""},
+	} {
+		result, err := rows[0].MatchText(example.block)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+
+	if _, err := rows[0].MatchText(selectorBlock{Selector: "llamas"}); err == nil {
+		t.Fatal("Expected an error for a selector that doesn't match")
+	}
+
+	rows, err = parseJSONRows([]byte(`{"results": {"b": {"name": "2"}, "a": {"name": "1"}}}`), "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0].Text() != `{"name":"1"}` {
+		t.Fatalf("Expected object rows to be ordered by key, got %v", rows)
+	}
+
+	if rows, err = parseJSONRows([]byte(`{"results": null}`), "results"); err != nil || len(rows) != 0 {
+		t.Fatalf("Expected no rows and no error for a null result, got %d and %v", len(rows), err)
+	}
+}
@@ -0,0 +1,443 @@
+package indexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	yamlErrorLineRegexp = regexp.MustCompile(`line (\d+)`)
+	quotedValueRegexp   = regexp.MustCompile(`"([^"]+)"`)
+)
+
+// LintError is a problem found in a definition file, Line is zero if it couldn't be located
+type LintError struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e LintError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	return msg
+}
+
+type lintErrors []LintError
+
+func (errs lintErrors) Error() string {
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// LintDefinitionFile validates a definition file without making any requests, bases that it
+// extends are loaded from the same directory or from the builtin definitions
+func LintDefinitionFile(fileName string) ([]LintError, error) {
+	src, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimSuffix(filepath.Base(fileName), ".yml")
+	fs := &fsLoader{[]string{filepath.Dir(fileName)}}
+
+	return lintDefinition(key, src, fs.source), nil
+}
+
+func lintDefinition(key string, src []byte, source sourceFunc) []LintError {
+	l := &linter{lines: parseYAMLLines(src), base: isBaseDefinition(key)}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		l.parseError(err)
+		return l.errors
+	}
+
+	merged, err := resolveExtends(key, src, source)
+	if err != nil {
+		l.errorf([]string{"extends"}, "%v", err)
+		return l.errors
+	}
+
+	def, err := ParseDefinition(merged)
+	if err != nil {
+		l.parseError(err)
+		return l.errors
+	}
+
+	if !l.base {
+		l.lintRequired(def)
+	}
+
+	l.lintLogin(def.Login)
+	l.lintRatio(def.Ratio)
+	l.lintSearch(def.Search)
+
+	l.lintSelectorBlock([]string{"download"}, def.Download.selectorBlock, responseTypeHTML)
+	if !def.Download.IsEmpty() {
+		for _, f := range def.Search.Fields {
+			if f.Field == "download" {
+				l.errorf([]string{"search", "fields", "download"},
+					"A download field can't be used when download has a selector, links are read from details pages")
+			}
+		}
+	}
+	for name, val := range def.Download.Headers {
+		l.lintTemplate([]string{"download", "headers", name}, val)
+	}
+	l.lintDownloadBefore(def.Download.Before)
+	l.lintErrorBlocks([]string{"download", "error"}, def.Download.Error)
+
+	return l.errors
+}
+
+type linter struct {
+	lines  []yamlLine
+	errors []LintError
+
+	// bases are partial definitions, so required keys are only checked in the definitions that
+	// extend them
+	base bool
+}
+
+func (l *linter) errorf(path []string, format string, args ...interface{}) {
+	l.errors = append(l.errors, LintError{
+		Line:    findYAMLLine(l.lines, path),
+		Path:    strings.Join(path, "."),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// parseError reports an error from parsing, yaml errors include a line number but errors from
+// unmarshaling blocks only sometimes include the value that was wrong
+func (l *linter) parseError(err error) {
+	lintErr := LintError{Message: err.Error()}
+
+	if m := yamlErrorLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+		lintErr.Line, _ = strconv.Atoi(m[1])
+	} else if m := quotedValueRegexp.FindStringSubmatch(err.Error()); m != nil {
+		for _, line := range l.lines {
+			if strings.Contains(line.text, m[1]) {
+				lintErr.Line = line.num
+				break
+			}
+		}
+	}
+
+	l.errors = append(l.errors, lintErr)
+}
+
+func (l *linter) lintRequired(def *IndexerDefinition) {
+	if def.Site == "" {
+		l.errorf([]string{"site"}, "A site key is required")
+	}
+	if def.Name == "" {
+		l.errorf([]string{"name"}, "A name is required")
+	}
+	if len(def.Links) == 0 {
+		l.errorf([]string{"links"}, "At least one link is required")
+	}
+	for idx, link := range def.Links {
+		if u, err := url.Parse(link); err != nil || !u.IsAbs() {
+			l.errorf([]string{"links", strconv.Itoa(idx)}, "Link %q must be an absolute url", link)
+		}
+	}
+}
+
+func (l *linter) lintLogin(login loginBlock) {
+	for idx, step := range login.loginSteps() {
+		path := []string{"login"}
+		if len(login.Steps) > 0 {
+			path = []string{"login", "steps", strconv.Itoa(idx)}
+		}
+
+		switch step.Method {
+		case "", loginMethodForm:
+			l.lintSelector(append(path, "form"), step.FormSelector, responseTypeHTML)
+		case loginMethodPost, loginMethodGet, loginMethodCookie, loginMethodHeader, loginMethodAPIKey:
+		default:
+			l.errorf(append(path, "method"), "Unknown login method %q", step.Method)
+		}
+
+		l.lintTemplate(append(path, "path"), step.Path)
+		for name, val := range step.Inputs {
+			l.lintTemplate(append(path, "inputs", name), val)
+		}
+		l.lintErrorBlocks(append(path, "error"), step.Error)
+	}
+
+	l.lintErrorBlocks([]string{"login", "error"}, login.Error)
+	l.lintSelector([]string{"login", "test", "selector"}, login.Test.Selector, responseTypeHTML)
+}
+
+func (l *linter) lintErrorBlocks(path []string, errs errorBlockOrSlice) {
+	for idx, e := range errs {
+		l.lintSelector(append(path, strconv.Itoa(idx), "selector"), e.Selector, responseTypeHTML)
+		l.lintSelectorBlock(append(path, strconv.Itoa(idx), "message"), e.Message, responseTypeHTML)
+	}
+}
+
+func (l *linter) lintRatio(ratio ratioBlock) {
+	l.lintTemplate([]string{"ratio", "path"}, ratio.Path)
+	l.lintSelectorBlock([]string{"ratio"}, ratio.selectorBlock, responseTypeHTML)
+	for name, val := range ratio.Headers {
+		l.lintTemplate([]string{"ratio", "headers", name}, val)
+	}
+}
+
+func (l *linter) lintDownloadBefore(before downloadBeforeBlock) {
+	switch before.Method {
+	case "", "get", "post":
+	default:
+		l.errorf([]string{"download", "before", "method"}, "Unknown download before method %q", before.Method)
+	}
+
+	l.lintTemplate([]string{"download", "before", "path"}, before.Path)
+	for name, val := range before.Inputs {
+		l.lintTemplate([]string{"download", "before", "inputs", name}, val)
+	}
+}
+
+func (l *linter) lintSearch(search searchBlock) {
+	responseType := search.Response.Type
+	switch responseType {
+	case "":
+		responseType = responseTypeHTML
+	case responseTypeHTML, responseTypeJSON, responseTypeXML:
+	default:
+		l.errorf([]string{"search", "response", "type"}, "Unknown response type %q", responseType)
+	}
+
+	for idx, p := range search.searchPaths() {
+		path := []string{"search"}
+		if len(search.Paths) > 0 {
+			path = []string{"search", "paths", strconv.Itoa(idx)}
+		}
+
+		switch p.Method {
+		case "", "get", "post":
+		default:
+			l.errorf(append(path, "method"), "Unknown search method %q", p.Method)
+		}
+
+		l.lintTemplate(append(path, "path"), p.Path)
+		for name, val := range p.Inputs {
+			l.lintTemplate(append(path, "inputs", name), val)
+		}
+	}
+
+	for name, val := range search.Inputs {
+		l.lintTemplate([]string{"search", "inputs", name}, val)
+	}
+	for name, val := range search.Headers {
+		l.lintTemplate([]string{"search", "headers", name}, val)
+	}
+
+	l.lintFilters([]string{"search", "keywordsfilters"}, search.KeywordsFilters)
+	l.lintFilters([]string{"search", "preprocessingfilters"}, search.PreprocessingFilters)
+
+	if !l.base && len(search.Rows.selectorList()) == 0 && search.Rows.TextVal == "" {
+		l.errorf([]string{"search", "rows", "selector"}, "A rows selector is required")
+	}
+	if responseType != responseTypeJSON {
+		l.lintSelector([]string{"search", "rows", "selector"}, search.Rows.Selector, responseType)
+		for idx, sel := range search.Rows.Selectors {
+			l.lintSelector([]string{"search", "rows", "selectors", strconv.Itoa(idx)}, sel, responseType)
+		}
+		l.lintSelector([]string{"search", "rows", "remove"}, search.Rows.Remove, responseType)
+	}
+	for idx, f := range search.Rows.Filters {
+		if _, err := invokeRowFilter(f.Name, f.Args, []searchRow{}, rowFilterContext{}); err != nil {
+			l.errorf([]string{"search", "rows", "filters", strconv.Itoa(idx)}, "%v", err)
+		}
+	}
+	l.lintSelectorBlock([]string{"search", "rows", "dateheaders"}, search.Rows.DateHeaders, responseType)
+
+	if !l.base && len(search.Fields) == 0 {
+		l.errorf([]string{"search", "fields"}, "At least one field is required")
+	}
+
+	l.lintFields([]string{"search", "fields"}, search.Fields, responseType)
+	l.lintFields([]string{"search", "details", "fields"}, search.Details.Fields, responseTypeHTML)
+
+	l.lintSelectorBlock([]string{"search", "paging", "next"}, search.Paging.Next, responseType)
+
+	if responseType != responseTypeJSON {
+		l.lintSelector([]string{"search", "noresults", "selector"}, search.NoResults.Selector, responseType)
+	}
+	l.lintErrorBlocks([]string{"search", "error"}, search.Error)
+}
+
+func (l *linter) lintFields(path []string, fields fieldsListBlock, responseType string) {
+	known := map[string]bool{}
+	for _, field := range resultFields {
+		known[field] = true
+	}
+
+	for _, f := range fields {
+		fieldPath := append(append([]string{}, path...), f.Field)
+		if !known[f.Field] && !isHelperField(f.Field) {
+			l.errorf(fieldPath, "Unknown field %q", f.Field)
+		}
+		if strings.Contains(f.Block.TextVal, "{{") {
+			l.lintTemplate(append(fieldPath, "text"), f.Block.TextVal)
+		}
+		l.lintSelectorBlock(fieldPath, f.Block, responseType)
+	}
+}
+
+func (l *linter) lintSelectorBlock(path []string, block selectorBlock, responseType string) {
+	if responseType != responseTypeJSON {
+		l.lintSelector(append(path, "selector"), block.Selector, responseType)
+		for idx, sel := range block.Selectors {
+			l.lintSelector(append(path, "selectors", strconv.Itoa(idx)), sel, responseType)
+		}
+		l.lintSelector(append(path, "remove"), block.Remove, responseType)
+		for _, c := range block.Case {
+			if c.Pattern != caseDefault {
+				l.lintSelector(append(path, "case", c.Pattern), c.Pattern, responseType)
+			}
+		}
+	}
+
+	l.lintFilters(append(path, "filters"), block.Filters)
+}
+
+func (l *linter) lintSelector(path []string, selector, responseType string) {
+	if selector == "" {
+		return
+	}
+	if responseType == responseTypeXML {
+		selector = xmlSelector(selector)
+	}
+	if _, err := cascadia.Compile(selector); err != nil {
+		l.errorf(path, "Invalid selector %q: %v", selector, err)
+	}
+}
+
+func (l *linter) lintFilters(path []string, blocks []filterBlock) {
+	for idx, f := range blocks {
+		filter, ok := filters[f.Name]
+		if !ok {
+			l.errorf(append(path, strconv.Itoa(idx)), "Unknown filter %q", f.Name)
+			continue
+		}
+		// filters check their arguments before they look at the value
+		if _, err := filter(f.Name, f.Args, "", time.UTC, englishNumbers); err != nil {
+			if _, ok := err.(filterArgsError); ok {
+				l.errorf(append(path, strconv.Itoa(idx)), "%v", err)
+			}
+		}
+	}
+}
+
+func (l *linter) lintTemplate(path []string, tpl string) {
+	if _, err := template.New(strings.Join(path, ".")).Funcs(templateFuncs).Parse(tpl); err != nil {
+		l.errorf(path, "Invalid template: %v", err)
+	}
+}
+
+// yamlLine is a line of a yaml document, list items are split into a line for the dash and a
+// line for the value after it so that they can be found by index
+type yamlLine struct {
+	num, indent int
+	key, text   string
+	item        bool
+}
+
+func parseYAMLLines(src []byte) []yamlLine {
+	lines := []yamlLine{}
+
+	for idx, raw := range strings.Split(string(src), "\n") {
+		text := strings.TrimLeft(raw, " ")
+		if text == "" || text == "---" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		indent := len(raw) - len(text)
+		for text == "-" || strings.HasPrefix(text, "- ") {
+			lines = append(lines, yamlLine{num: idx + 1, indent: indent, text: text, item: true})
+			rest := strings.TrimLeft(text[1:], " ")
+			indent += len(text) - len(rest)
+			text = rest
+		}
+
+		if text != "" {
+			lines = append(lines, yamlLine{num: idx + 1, indent: indent, key: yamlKey(text), text: text})
+		}
+	}
+
+	return lines
+}
+
+func yamlKey(text string) string {
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			if key, err := strconv.Unquote(text[:i]); err == nil {
+				return key
+			}
+			return strings.Trim(text[:i], `'`)
+		}
+	}
+	return ""
+}
+
+// findYAMLLine returns the line of the key at path, or the line of the closest parent found
+func findYAMLLine(lines []yamlLine, path []string) int {
+	var found int
+	start, parent := 0, -1
+
+	for _, seg := range path {
+		idx, err := strconv.Atoi(seg)
+		isIndex := err == nil
+
+		child, count, matched := -1, 0, -1
+		for i := start; i < len(lines) && matched == -1; i++ {
+			line := lines[i]
+			if line.indent <= parent {
+				break
+			}
+			if child == -1 {
+				child = line.indent
+			}
+			if line.indent != child {
+				continue
+			}
+			if isIndex && line.item {
+				if count == idx {
+					matched = i
+				}
+				count++
+			} else if !isIndex && line.key == seg {
+				matched = i
+			}
+		}
+
+		if matched == -1 {
+			return found
+		}
+
+		found = lines[matched].num
+		start, parent = matched+1, lines[matched].indent
+	}
+
+	return found
+}
@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+)
+
+const exampleLintDefinition = `
+---
+  site: example
+  name: Example
+  links:
+    - https://example.org/
+
+  login:
+    path: /login.php
+    method: %s
+    inputs:
+      username: "{{ .Config.username }}"
+
+  search:
+    path: /torrents.php
+    inputs:
+      q: "%s"
+    rows:
+      selector: "%s"
+    fields:
+      title:
+        selector: a
+        filters:
+          - name: trim
+            args: " "
+          - name: %s
+            args: %s
+      %s:
+        selector: td.size
+`
+
+func TestLintDefinition(t *testing.T) {
+	for idx, example := range []struct {
+		method, input, rows, filter, args, field string
+		expected                                 []LintError
+	}{
+		{"post", "{{ .Keywords }}", "tr", "tolower", "", "size", []LintError{}},
+		{"fax", "{{ .Keywords }}", "tr", "tolower", "", "size", []LintError{
+			{Line: 10, Path: "login.method", Message: `Unknown login method "fax"`},
+		}},
+		{"post", "{{ .Keywords }", "tr", "tolower", "", "size", []LintError{
+			{Line: 17, Path: "search.inputs.q", Message: `Invalid template: template: search.inputs.q:1: unexpected "}" in operand`},
+		}},
+		{"post", "{{ .Keywords }}", "tr:nth-child(", "tolower", "", "size", []LintError{
+			{Line: 19, Path: "search.rows.selector", Message: `Invalid selector "tr:nth-child(": unexpected EOF while attempting to parse expression of form an+b`},
+		}},
+		{"post", "{{ .Keywords }}", "tr", "tolowre", "", "size", []LintError{
+			{Line: 26, Path: "search.fields.title.filters.1", Message: `Unknown filter "tolowre"`},
+		}},
+		{"post", "{{ .Keywords }}", "tr", "diacritics", "llamas", "size", []LintError{
+			{Line: 26, Path: "search.fields.title.filters.1", Message: `Filter "diacritics" doesn't take any arguments`},
+		}},
+		{"post", "{{ .Keywords }}", "tr", "split", "llamas", "size", []LintError{
+			{Line: 26, Path: "search.fields.title.filters.1", Message: `Filter "split" requires a separator and a position`},
+		}},
+		{"post", "{{ .Keywords }}", "tr", "tolower", "", "szie", []LintError{
+			{Line: 28, Path: "search.fields.szie", Message: `Unknown field "szie"`},
+		}},
+	} {
+		src := []byte(fmt.Sprintf(exampleLintDefinition, example.method, example.input, example.rows, example.filter, example.args, example.field))
+		errs := lintDefinition("example", src, exampleExtendsSource)
+
+		if len(errs) != len(example.expected) {
+			t.Fatalf("Row #%d expected %d errors, got %v", idx+1, len(example.expected), errs)
+		}
+		for i, err := range errs {
+			if err.Line != example.expected[i].Line || err.Path != example.expected[i].Path {
+				t.Fatalf("Row #%d expected error at line %d %s, got line %d %s",
+					idx+1, example.expected[i].Line, example.expected[i].Path, err.Line, err.Path)
+			}
+			if err.Message != example.expected[i].Message {
+				t.Fatalf("Row #%d expected message %q, got %q", idx+1, example.expected[i].Message, err.Message)
+			}
+		}
+	}
+}
+
+func TestLintDefinitionParseErrors(t *testing.T) {
+	for idx, example := range []struct {
+		src  string
+		line int
+	}{
+		{"---\n  site: example\n  links: [\n", 3},
+		{"---\n  site: example\n  caps:\n    categories:\n      1: Llamas/HD\n", 5},
+		{"---\n  site: example\n  extends: _missing\n", 3},
+	} {
+		errs := lintDefinition("example", []byte(example.src), exampleExtendsSource)
+		if len(errs) != 1 || errs[0].Line != example.line {
+			t.Fatalf("Row #%d expected a single error on line %d, got %v", idx+1, example.line, errs)
+		}
+	}
+}
+
+func TestFindYAMLLine(t *testing.T) {
+	lines := parseYAMLLines([]byte(exampleExtendsSources["example"]))
+
+	for idx, example := range []struct {
+		path []string
+		line int
+	}{
+		{[]string{"site"}, 3},
+		{[]string{"links", "0"}, 7},
+		{[]string{"login", "inputs", "username"}, 10},
+		{[]string{"search", "fields", "seeders", "selector"}, 16},
+		{[]string{"search", "fields", "leechers"}, 12},
+		{[]string{"ratio"}, 0},
+	} {
+		if line := findYAMLLine(lines, example.path); line != example.line {
+			t.Fatalf("Row #%d expected line %d, got %d", idx+1, example.line, line)
+		}
+	}
+}
+
+func TestLintBuiltinDefinitions(t *testing.T) {
+	loader := escLoader{Dir(false, "")}
+
+	keys, err := loader.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		src, err := loader.source(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := lintDefinition(key, src, loader.source); len(errs) > 0 {
+			t.Errorf("Builtin definition %s has lint errors: %v", key, lintErrors(errs))
+		}
+	}
+}
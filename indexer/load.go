@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/cardigann/cardigann/config"
+	"github.com/cardigann/cardigann/logger"
 )
 
 var (
@@ -93,12 +94,30 @@ func (fs *fsLoader) List() ([]string, error) {
 	results := []string{}
 
 	for k := range defs {
-		results = append(results, k)
+		if !isBaseDefinition(k) {
+			results = append(results, k)
+		}
 	}
 
 	return results, nil
 }
 
+// source returns the yaml for a definition, falling back to the builtin definitions so that
+// definitions on the filesystem can extend builtin bases
+func (fs *fsLoader) source(key string) ([]byte, error) {
+	defs, err := fs.walkDirectories()
+	if err != nil {
+		return nil, err
+	}
+
+	fileName, ok := defs[key]
+	if !ok {
+		return escLoader{Dir(false, "")}.source(key)
+	}
+
+	return ioutil.ReadFile(fileName)
+}
+
 func (fs *fsLoader) Load(key string) (*IndexerDefinition, error) {
 	defs, err := fs.walkDirectories()
 	if err != nil {
@@ -110,16 +129,30 @@ func (fs *fsLoader) Load(key string) (*IndexerDefinition, error) {
 		return nil, ErrUnknownIndexer
 	}
 
-	f, err := os.Open(fileName)
+	data, err := ioutil.ReadFile(fileName)
 	if err != nil {
 		return nil, err
 	}
 
-	def, err := ParseDefinitionFile(f)
+	if errs := lintDefinition(key, data, fs.source); len(errs) > 0 {
+		return nil, fmt.Errorf("Invalid definition %s: %v", fileName, lintErrors(errs))
+	}
+
+	if data, err = resolveExtends(key, data, fs.source); err != nil {
+		return nil, err
+	}
+
+	def, err := ParseDefinition(data)
 	if err != nil {
 		return def, err
 	}
 
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return def, err
+	}
+
+	def.stats.ModTime = fi.ModTime()
 	def.stats.Source = "file:" + fileName
 	return def, err
 }
@@ -154,7 +187,10 @@ func (ml multiLoader) Load(key string) (*IndexerDefinition, error) {
 
 	for _, loader := range ml {
 		loaded, err := loader.Load(key)
-		if err != nil {
+		if err == ErrUnknownIndexer {
+			continue
+		} else if err != nil {
+			logger.Logger.WithError(err).Warnf("Failed to load definition %s", key)
 			continue
 		}
 		if def == nil || loaded.Stats().ModTime.After(def.Stats().ModTime) {
@@ -179,7 +215,7 @@ func (el escLoader) List() ([]string, error) {
 	results := []string{}
 
 	for filename := range _escData {
-		if matches := escFilenameRegex.FindStringSubmatch(filename); matches != nil {
+		if matches := escFilenameRegex.FindStringSubmatch(filename); matches != nil && !isBaseDefinition(matches[1]) {
 			results = append(results, matches[1])
 		}
 	}
@@ -187,6 +223,18 @@ func (el escLoader) List() ([]string, error) {
 	return results, nil
 }
 
+func (el escLoader) source(key string) ([]byte, error) {
+	f, err := el.Open(fmt.Sprintf("/definitions/%s.yml", key))
+	if os.IsNotExist(err) {
+		return nil, ErrUnknownIndexer
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
 func (el escLoader) Load(key string) (*IndexerDefinition, error) {
 	fname := fmt.Sprintf("/definitions/%s.yml", key)
 	f, err := el.Open(fname)
@@ -202,6 +250,10 @@ func (el escLoader) Load(key string) (*IndexerDefinition, error) {
 		return nil, err
 	}
 
+	if data, err = resolveExtends(key, data, el.source); err != nil {
+		return nil, err
+	}
+
 	def, err := ParseDefinition(data)
 	if err != nil {
 		return def, err
@@ -0,0 +1,113 @@
+package indexer
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	sizeUnitsBinary  = "binary"
+	sizeUnitsDecimal = "decimal"
+)
+
+// numberFormat is the thousands and decimal separators that a site uses
+type numberFormat struct {
+	thousands, decimal string
+}
+
+var (
+	englishNumbers  = numberFormat{thousands: ",", decimal: "."}
+	europeanNumbers = numberFormat{thousands: ".", decimal: ","}
+
+	// numberformat is written as the number 1234.56 formatted the way the site formats it
+	numberFormatRegexp = regexp.MustCompile(`^1(\D?)234(\D)56$`)
+
+	sizeRegexp = regexp.MustCompile(`(?i)^([\d\s.,']+?)\s*([kmgtpe]?)(i?)(?:b|o|bytes?|octets?)?$`)
+
+	// languages that use a decimal comma, anything else uses a decimal point
+	decimalCommaLanguages = []string{
+		"cs", "da", "de", "es", "fi", "fr", "hu", "it", "nb", "nl", "no", "pl", "pt", "ro", "ru", "sv", "tr",
+	}
+)
+
+func parseNumberFormat(example string) (numberFormat, error) {
+	m := numberFormatRegexp.FindStringSubmatch(example)
+	if m == nil || m[1] == m[2] {
+		return numberFormat{}, fmt.Errorf("Invalid numberformat %q, expected 1234.56 formatted like \"1,234.56\"", example)
+	}
+	return numberFormat{thousands: m[1], decimal: m[2]}, nil
+}
+
+func languageNumberFormat(language string) numberFormat {
+	lang := strings.ToLower(strings.SplitN(language, "-", 2)[0])
+	for _, l := range decimalCommaLanguages {
+		if l == lang {
+			return europeanNumbers
+		}
+	}
+	return englishNumbers
+}
+
+// normalizeNumber converts a formatted number into one that strconv can parse. A number that
+// only has one separator with 3 digits after it is ambiguous, so the format decides whether it's
+// a decimal or a thousands separator, otherwise the last separator is the decimal one
+func normalizeNumber(s string, f numberFormat) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' || r == '’' {
+			return -1
+		}
+		return r
+	}, s)
+
+	if s == "" {
+		return "0"
+	}
+
+	lastComma, lastDot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	if lastComma == -1 && lastDot == -1 {
+		return s
+	}
+
+	sep, other, last := ",", ".", lastComma
+	if lastDot > lastComma {
+		sep, other, last = ".", ",", lastDot
+	}
+
+	if strings.Contains(s, other) {
+		return strings.Replace(strings.Replace(s, other, "", -1), sep, ".", 1)
+	} else if strings.Count(s, sep) > 1 || (len(s)-last-1 == 3 && sep != f.decimal) {
+		return strings.Replace(s, sep, "", -1)
+	}
+
+	return strings.Replace(s, sep, ".", 1)
+}
+
+// parseSize parses a size like "1,5 GB" into bytes, units are binary if binary is set or the
+// unit says so like GiB
+func parseSize(s string, f numberFormat, binary bool) (uint64, error) {
+	m := sizeRegexp.FindStringSubmatch(normalizeSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("Failed to parse size %q", s)
+	}
+
+	number, err := strconv.ParseFloat(normalizeNumber(m[1], f), 64)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse size %q: %v", s, err)
+	}
+
+	base := 1000.0
+	if binary || m[3] != "" {
+		base = 1024
+	}
+
+	var exp float64
+	if m[2] != "" {
+		exp = float64(strings.Index("kmgtpe", strings.ToLower(m[2])) + 1)
+	}
+
+	return uint64(math.Floor(number*math.Pow(base, exp) + 0.5)), nil
+}
@@ -0,0 +1,121 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalizeNumber(t *testing.T) {
+	for idx, example := range []struct {
+		value    string
+		format   numberFormat
+		expected string
+	}{
+		{"1234", englishNumbers, "1234"},
+		{"1,234", englishNumbers, "1234"},
+		{"1.234", englishNumbers, "1.234"},
+		{"1,234.56", englishNumbers, "1234.56"},
+		{"1,234,567", englishNumbers, "1234567"},
+		{"1,5", englishNumbers, "1.5"},
+		{"1.234", europeanNumbers, "1234"},
+		{"1,234", europeanNumbers, "1.234"},
+		{"1.234,56", europeanNumbers, "1234.56"},
+		{"1.234.567", europeanNumbers, "1234567"},
+		{"1.5", europeanNumbers, "1.5"},
+		{"1 234,56", numberFormat{" ", ","}, "1234.56"},
+		{"1 234", numberFormat{" ", ","}, "1234"},
+		{"1'234.56", numberFormat{"'", "."}, "1234.56"},
+		{"", englishNumbers, "0"},
+	} {
+		if got := normalizeNumber(example.value, example.format); got != example.expected {
+			t.Fatalf("Row #%d expected %q to normalize to %q, got %q", idx+1, example.value, example.expected, got)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for idx, example := range []struct {
+		value    string
+		format   numberFormat
+		binary   bool
+		expected uint64
+	}{
+		{"4GB", englishNumbers, true, 4294967296},
+		{"4GB", englishNumbers, false, 4000000000},
+		{"4 GiB", englishNumbers, false, 4294967296},
+		{"1.5 MB", englishNumbers, true, 1572864},
+		{"1,234 KB", englishNumbers, false, 1234000},
+		{"1,234 KB", europeanNumbers, false, 1234},
+		{"1,5 Go", europeanNumbers, true, 1610612736},
+		{"1.234,56 MB", europeanNumbers, false, 1234560000},
+		{"512 bytes", englishNumbers, true, 512},
+		{"100", englishNumbers, true, 100},
+		{"2 TB", englishNumbers, true, 2199023255552},
+	} {
+		got, err := parseSize(example.value, example.format, example.binary)
+		if err != nil {
+			t.Fatalf("Row #%d failed to parse %q: %v", idx+1, example.value, err)
+		}
+		if got != example.expected {
+			t.Fatalf("Row #%d expected %q to be %d bytes, got %d", idx+1, example.value, example.expected, got)
+		}
+	}
+
+	for _, value := range []string{"", "GB", "lots"} {
+		if _, err := parseSize(value, englishNumbers, true); err == nil {
+			t.Fatalf("Expected an error parsing size %q", value)
+		}
+	}
+}
+
+func TestDefinitionNumberFormat(t *testing.T) {
+	for idx, example := range []struct {
+		keys     string
+		format   numberFormat
+		binary   bool
+		errorMsg string
+	}{
+		{"", englishNumbers, true, ""},
+		{"language: de-de", europeanNumbers, true, ""},
+		{"language: fr-fr\n  sizeunits: decimal", europeanNumbers, false, ""},
+		{"language: de-de\n  numberformat: \"1,234.56\"", englishNumbers, true, ""},
+		{"numberformat: \"1 234,56\"", numberFormat{" ", ","}, true, ""},
+		{"numberformat: \"1234.56\"", numberFormat{"", "."}, true, ""},
+		{"numberformat: \"1.234.56\"", numberFormat{}, false, `Invalid numberformat "1.234.56", expected 1234.56 formatted like "1,234.56"`},
+		{"sizeunits: metric", numberFormat{}, false, `Unknown sizeunits "metric", expected binary or decimal`},
+	} {
+		def, err := ParseDefinition([]byte(fmt.Sprintf("---\n  site: example\n  %s\n", example.keys)))
+		if example.errorMsg != "" {
+			if err == nil || err.Error() != example.errorMsg {
+				t.Fatalf("Row #%d expected error %q, got %v", idx+1, example.errorMsg, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("Row #%d failed to parse: %v", idx+1, err)
+		}
+
+		if f := def.numberFormat(); f != example.format {
+			t.Fatalf("Row #%d expected number format %#v, got %#v", idx+1, example.format, f)
+		}
+		if def.binarySizes() != example.binary {
+			t.Fatalf("Row #%d expected binary sizes to be %v", idx+1, example.binary)
+		}
+	}
+}
+
+func TestBuiltinDefinitionNumberFormat(t *testing.T) {
+	for _, key := range []string{"theshinning", "torrentsectorcrew"} {
+		def, err := escLoader{Dir(false, "")}.Load(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := parseSize("1.234,5 MB", def.numberFormat(), def.binarySizes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != 1294467072 {
+			t.Fatalf("Expected %s to parse 1.234,5 MB as 1294467072 bytes, got %d", key, size)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,16 +19,24 @@ import (
 
 type IndexerDefinition struct {
 	Site         string                 `yaml:"site"`
+	Extends      string                 `yaml:"extends"`
 	Settings     []settingsField        `yaml:"settings"`
 	Name         string                 `yaml:"name"`
 	Description  string                 `yaml:"description"`
 	Language     string                 `yaml:"language"`
+	Encoding     string                 `yaml:"encoding"`
+	Timezone     string                 `yaml:"timezone"`
+	NumberFormat string                 `yaml:"numberformat"`
+	SizeUnits    string                 `yaml:"sizeunits"`
 	Links        stringorslice          `yaml:"links"`
 	Capabilities capabilitiesBlock      `yaml:"caps"`
 	Login        loginBlock             `yaml:"login"`
 	Ratio        ratioBlock             `yaml:"ratio"`
 	Search       searchBlock            `yaml:"search"`
+	Download     downloadBlock          `yaml:"download"`
 	stats        IndexerDefinitionStats `yaml:"-"`
+	location     *time.Location
+	numbers      *numberFormat
 }
 
 type IndexerDefinitionStats struct {
@@ -41,18 +50,120 @@ func (id *IndexerDefinition) Stats() IndexerDefinitionStats {
 	return id.stats
 }
 
+// Location returns the time zone that dates without an offset are in, which defaults to UTC
+func (id *IndexerDefinition) Location() *time.Location {
+	if id.location == nil {
+		return time.UTC
+	}
+	return id.location
+}
+
+// numberFormat returns the separators that numbers are parsed with, which are set with
+// numberformat or otherwise guessed from the language
+func (id *IndexerDefinition) numberFormat() numberFormat {
+	if id.numbers == nil {
+		return languageNumberFormat(id.Language)
+	}
+	return *id.numbers
+}
+
+// binarySizes returns whether sizes like GB are 1024 based, which is what most sites mean
+func (id *IndexerDefinition) binarySizes() bool {
+	return id.SizeUnits != sizeUnitsDecimal
+}
+
+const (
+	settingTypeText     = "text"
+	settingTypePassword = "password"
+	settingTypeCheckbox = "checkbox"
+	settingTypeSelect   = "select"
+)
+
 type settingsField struct {
-	Name  string `yaml:"name"`
-	Type  string `yaml:"type"`
-	Label string `yaml:"label"`
+	Name    string          `yaml:"name"`
+	Type    string          `yaml:"type"`
+	Label   string          `yaml:"label"`
+	Options settingsOptions `yaml:"options"`
+	Default string          `yaml:"default"`
+}
+
+// DefaultValue returns the value used when a setting isn't configured, checkboxes are unchecked
+// and selects use their first option unless they have a default
+func (s settingsField) DefaultValue() string {
+	switch {
+	case s.Default != "":
+		return s.Default
+	case s.Type == settingTypeCheckbox:
+		return "false"
+	case s.Type == settingTypeSelect && len(s.Options) > 0:
+		return s.Options[0].Value
+	}
+	return ""
+}
+
+// Optional returns whether a setting can be left unconfigured and use its default value
+func (s settingsField) Optional() bool {
+	return s.Type == settingTypeCheckbox || s.Type == settingTypeSelect || s.Default != ""
+}
+
+// Validate returns an error if value isn't valid for the setting
+func (s settingsField) Validate(value string) error {
+	switch s.Type {
+	case settingTypeCheckbox:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("Setting %s must be true or false, got %q", s.Name, value)
+		}
+	case settingTypeSelect:
+		for _, o := range s.Options {
+			if o.Value == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("Setting %s must be one of the options, got %q", s.Name, value)
+	}
+	return nil
+}
+
+type settingsOption struct {
+	Value string
+	Label string
+}
+
+// settingsOptions are the options of a select setting, written as a map of value to label
+type settingsOptions []settingsOption
+
+func (o *settingsOptions) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Unmarshal as a MapSlice to preserve order of options
+	var options yaml.MapSlice
+	if err := unmarshal(&options); err != nil {
+		return errors.New("Failed to unmarshal settingsOptions")
+	}
+
+	for _, item := range options {
+		*o = append(*o, settingsOption{
+			Value: fmt.Sprintf("%v", item.Key),
+			Label: fmt.Sprintf("%v", item.Value),
+		})
+	}
+
+	return nil
 }
 
+// ParseDefinitionFile parses a definition file, bases that it extends are loaded from the
+// same directory or from the builtin definitions
 func ParseDefinitionFile(f *os.File) (*IndexerDefinition, error) {
 	b, err := ioutil.ReadFile(f.Name())
 	if err != nil {
 		return nil, err
 	}
 
+	key := strings.TrimSuffix(filepath.Base(f.Name()), ".yml")
+	fs := &fsLoader{[]string{filepath.Dir(f.Name())}}
+
+	if b, err = resolveExtends(key, b, fs.source); err != nil {
+		return nil, err
+	}
+
 	def, err := ParseDefinition(b)
 	if err != nil {
 		return nil, err
@@ -86,6 +197,55 @@ func ParseDefinition(src []byte) (*IndexerDefinition, error) {
 		def.Settings = defaultSettingsFields()
 	}
 
+	if _, err := lookupEncoding(def.Encoding); err != nil {
+		return nil, err
+	}
+
+	for _, setting := range def.Settings {
+		switch setting.Type {
+		case "", settingTypeText, settingTypePassword, settingTypeCheckbox:
+		case settingTypeSelect:
+			if len(setting.Options) == 0 {
+				return nil, fmt.Errorf("Select setting %s has no options", setting.Name)
+			}
+		default:
+			return nil, fmt.Errorf("Setting %s has unknown type %q", setting.Name, setting.Type)
+		}
+		if setting.Default != "" {
+			if err := setting.Validate(setting.Default); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if def.Timezone != "" {
+		loc, err := time.LoadLocation(def.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Unknown timezone %q: %v", def.Timezone, err)
+		}
+		def.location = loc
+	}
+
+	if def.NumberFormat != "" {
+		f, err := parseNumberFormat(def.NumberFormat)
+		if err != nil {
+			return nil, err
+		}
+		def.numbers = &f
+	}
+
+	switch def.SizeUnits {
+	case "", sizeUnitsBinary, sizeUnitsDecimal:
+	default:
+		return nil, fmt.Errorf("Unknown sizeunits %q, expected %s or %s", def.SizeUnits, sizeUnitsBinary, sizeUnitsDecimal)
+	}
+
+	for _, p := range def.Search.Paths {
+		if _, err := p.torznabCategories(); err != nil {
+			return nil, err
+		}
+	}
+
 	def.stats = IndexerDefinitionStats{
 		Size:    int64(len(src)),
 		ModTime: time.Now(),
@@ -97,8 +257,8 @@ func ParseDefinition(src []byte) (*IndexerDefinition, error) {
 
 func defaultSettingsFields() []settingsField {
 	return []settingsField{
-		{Name: "username", Label: "Username", Type: "text"},
-		{Name: "password", Label: "Password", Type: "password"},
+		{Name: "username", Label: "Username", Type: settingTypeText},
+		{Name: "password", Label: "Password", Type: settingTypePassword},
 	}
 }
 
@@ -161,6 +321,8 @@ const (
 	loginMethodGet    = "get"
 	loginMethodForm   = "form"
 	loginMethodCookie = "cookie"
+	loginMethodHeader = "header"
+	loginMethodAPIKey = "apikey"
 )
 
 type loginBlock struct {
@@ -170,16 +332,51 @@ type loginBlock struct {
 	Inputs       inputsBlock       `yaml:"inputs,omitempty"`
 	Error        errorBlockOrSlice `yaml:"error,omitempty"`
 	Test         pageTestBlock     `yaml:"test,omitempty"`
+	Steps        []loginStepBlock  `yaml:"steps,omitempty"`
 }
 
 func (l *loginBlock) IsEmpty() bool {
-	return l.Path == "" && l.Method == ""
+	return l.Path == "" && l.Method == "" && len(l.Steps) == 0
 }
 
 func (l *loginBlock) hasError(browser browser.Browsable) error {
-	for _, e := range l.Error {
-		if e.matchPage(browser) {
-			msg, err := e.errorText(browser.Dom())
+	return l.Error.hasError(browser)
+}
+
+// loginSteps returns the steps to run in order, a login block without steps is a single step
+func (l *loginBlock) loginSteps() []loginStepBlock {
+	if len(l.Steps) == 0 {
+		return []loginStepBlock{{
+			Path:         l.Path,
+			FormSelector: l.FormSelector,
+			Method:       l.Method,
+			Inputs:       l.Inputs,
+		}}
+	}
+
+	steps := []loginStepBlock{}
+	for _, step := range l.Steps {
+		if step.FormSelector == "" {
+			step.FormSelector = l.FormSelector
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// loginStepBlock is a single request in a multi-step login flow
+type loginStepBlock struct {
+	Path         string            `yaml:"path"`
+	FormSelector string            `yaml:"form"`
+	Method       string            `yaml:"method"`
+	Inputs       inputsBlock       `yaml:"inputs,omitempty"`
+	Error        errorBlockOrSlice `yaml:"error,omitempty"`
+}
+
+func (e errorBlockOrSlice) hasError(browser browser.Browsable) error {
+	for _, b := range e {
+		if b.matchPage(browser) {
+			msg, err := b.errorText(browser.Dom())
 			if err != nil {
 				return err
 			}
@@ -258,11 +455,138 @@ const (
 )
 
 type searchBlock struct {
-	Path   string          `yaml:"path"`
-	Method string          `yaml:"method"`
-	Inputs inputsBlock     `yaml:"inputs,omitempty"`
-	Rows   rowsBlock       `yaml:"rows"`
-	Fields fieldsListBlock `yaml:"fields"`
+	Path                 string            `yaml:"path"`
+	Method               string            `yaml:"method"`
+	Inputs               inputsBlock       `yaml:"inputs,omitempty"`
+	Headers              inputsBlock       `yaml:"headers,omitempty"`
+	KeywordsFilters      []filterBlock     `yaml:"keywordsfilters,omitempty"`
+	KeywordsMinLength    int               `yaml:"keywordsminlength"`
+	PreprocessingFilters []filterBlock     `yaml:"preprocessingfilters,omitempty"`
+	Response             responseBlock     `yaml:"response"`
+	Rows                 rowsBlock         `yaml:"rows"`
+	Fields               fieldsListBlock   `yaml:"fields"`
+	Details              detailsBlock      `yaml:"details"`
+	Paging               pagingBlock       `yaml:"paging"`
+	Paths                []searchPath      `yaml:"paths"`
+	NoResults            noResultsBlock    `yaml:"noresults"`
+	Error                errorBlockOrSlice `yaml:"error,omitempty"`
+}
+
+// searchPaths returns the paths to search, a single path is used if no paths are listed
+func (s *searchBlock) searchPaths() []searchPath {
+	if len(s.Paths) == 0 {
+		return []searchPath{{Path: s.Path, Method: s.Method}}
+	}
+
+	paths := []searchPath{}
+	for _, p := range s.Paths {
+		if p.Method == "" {
+			p.Method = s.Method
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// searchPath is a search endpoint that is optionally limited to some torznab categories or
+// search modes. Its inputs are merged over the inputs of the search block
+type searchPath struct {
+	Path       string        `yaml:"path"`
+	Method     string        `yaml:"method"`
+	Inputs     inputsBlock   `yaml:"inputs,omitempty"`
+	Categories stringorslice `yaml:"categories"`
+	Modes      stringorslice `yaml:"modes"`
+}
+
+// torznabCategories resolves the category names that the path is limited to
+func (p *searchPath) torznabCategories() (torznab.Categories, error) {
+	cats := torznab.Categories{}
+
+	for _, catName := range p.Categories {
+		matchedCat := false
+		for _, cat := range torznab.AllCategories {
+			if cat.Name == catName {
+				cats = append(cats, cat)
+				matchedCat = true
+				break
+			}
+		}
+		if !matchedCat {
+			return nil, fmt.Errorf("Unknown category %q in search path %q", catName, p.Path)
+		}
+	}
+
+	return cats, nil
+}
+
+// matchesQuery returns true if the path should be searched for the query
+func (p *searchPath) matchesQuery(query torznab.Query) bool {
+	if len(p.Modes) > 0 {
+		var matchMode bool
+		for _, m := range p.Modes {
+			if (torznab.Query{Type: m}).Mode() == query.Mode() {
+				matchMode = true
+			}
+		}
+		if !matchMode {
+			return false
+		}
+	}
+
+	if len(p.Categories) == 0 || len(query.Categories) == 0 {
+		return true
+	}
+
+	cats, _ := p.torznabCategories()
+
+	for _, queryCat := range torznab.AllCategories.Subset(query.Categories...) {
+		for _, cat := range cats {
+			if cat.ID == queryCat.ID ||
+				cat.ID == torznab.ParentCategory(queryCat).ID ||
+				queryCat.ID == torznab.ParentCategory(cat).ID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+const defaultMaxPages = 5
+
+// pagingBlock describes how to request further pages of search results, either by following
+// a next page link or by setting a page number input. The page number is also available to
+// search templates as .Page
+type pagingBlock struct {
+	Next     selectorBlock `yaml:"next"`
+	Input    string        `yaml:"input"`
+	Start    int           `yaml:"start"`
+	MaxPages int           `yaml:"maxpages"`
+}
+
+func (p *pagingBlock) IsEmpty() bool {
+	return p.Next.IsEmpty() && p.Input == "" && p.MaxPages == 0
+}
+
+// maxPages returns the most pages that will be requested for a single search
+func (p *pagingBlock) maxPages() int {
+	if p.MaxPages > 0 {
+		return p.MaxPages
+	} else if p.IsEmpty() {
+		return 1
+	}
+	return defaultMaxPages
+}
+
+// noResultsBlock recognizes the page a tracker returns when a search finds nothing, either by a
+// selector that matches on the page or by text that the response body contains
+type noResultsBlock struct {
+	Selector string `yaml:"selector"`
+	Text     string `yaml:"text"`
+}
+
+func (n *noResultsBlock) IsEmpty() bool {
+	return n.Selector == "" && n.Text == ""
 }
 
 type capabilitiesBlock struct {
@@ -360,7 +684,8 @@ func (s *stringorslice) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 type ratioBlock struct {
 	selectorBlock
-	Path string `yaml:"path"`
+	Path    string      `yaml:"path"`
+	Headers inputsBlock `yaml:"headers"`
 }
 
 func (r *ratioBlock) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -370,7 +695,8 @@ func (r *ratioBlock) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	}
 
 	var rb struct {
-		Path string `yaml:"path"`
+		Path    string      `yaml:"path"`
+		Headers inputsBlock `yaml:"headers"`
 	}
 	if err := unmarshal(&rb); err != nil {
 		return errors.New("Failed to unmarshal ratioBlock")
@@ -378,5 +704,48 @@ func (r *ratioBlock) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	r.selectorBlock = sb
 	r.Path = rb.Path
+	r.Headers = rb.Headers
 	return nil
 }
+
+// downloadBlock configures downloads, if it has a selector then links are details pages and the
+// selector extracts the download link from them
+type downloadBlock struct {
+	selectorBlock
+	Headers inputsBlock         `yaml:"headers"`
+	Before  downloadBeforeBlock `yaml:"before"`
+	Error   errorBlockOrSlice   `yaml:"error"`
+}
+
+func (d *downloadBlock) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var sb selectorBlock
+	if err := unmarshal(&sb); err != nil {
+		return errors.New("Failed to unmarshal downloadBlock")
+	}
+
+	var db struct {
+		Headers inputsBlock         `yaml:"headers"`
+		Before  downloadBeforeBlock `yaml:"before"`
+		Error   errorBlockOrSlice   `yaml:"error"`
+	}
+	if err := unmarshal(&db); err != nil {
+		return errors.New("Failed to unmarshal downloadBlock")
+	}
+
+	d.selectorBlock = sb
+	d.Headers = db.Headers
+	d.Before = db.Before
+	d.Error = db.Error
+	return nil
+}
+
+// downloadBeforeBlock is a request made before a download, like thanking the uploader
+type downloadBeforeBlock struct {
+	Path   string      `yaml:"path"`
+	Method string      `yaml:"method"`
+	Inputs inputsBlock `yaml:"inputs"`
+}
+
+func (d *downloadBeforeBlock) IsEmpty() bool {
+	return d.Path == ""
+}
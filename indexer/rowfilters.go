@@ -0,0 +1,143 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+// rowFilterContext is the state that row filters have access to
+type rowFilterContext struct {
+	Query torznab.Query
+	// Keywords are the query keywords after the keywords filters, which is what was searched for
+	Keywords string
+	Fields   fieldsListBlock
+}
+
+// fieldText extracts a field from a copy of a row, returning false if the field isn't defined or didn't match
+func (ctx rowFilterContext) fieldText(field string, row searchRow) (string, bool) {
+	for _, item := range ctx.Fields {
+		if item.Field == field {
+			val, err := row.Clone().MatchText(item.Block)
+			if err != nil {
+				return "", false
+			}
+			return val, true
+		}
+	}
+	return "", false
+}
+
+func invokeRowFilter(name string, args interface{}, rows []searchRow, ctx rowFilterContext) ([]searchRow, error) {
+	switch name {
+	case "andmatch":
+		if args != nil {
+			return nil, fmt.Errorf("Row filter %q doesn't take any arguments", name)
+		}
+		return rowFilterAndMatch(rows, ctx), nil
+
+	case "limit":
+		limit, ok := args.(int)
+		if !ok || limit < 0 {
+			return nil, fmt.Errorf("Row filter %q requires a positive int argument", name)
+		}
+		return rowFilterLimit(limit, rows), nil
+
+	case "dedupe":
+		if args == nil {
+			return rowFilterDedupe("", rows, ctx), nil
+		}
+		field, ok := args.(string)
+		if !ok {
+			return nil, fmt.Errorf("Row filter %q requires a string argument", name)
+		}
+		return rowFilterDedupe(field, rows, ctx), nil
+	}
+
+	return nil, errors.New("Unknown row filter " + name)
+}
+
+// normalizeForMatch lowercases a string and replaces punctuation with spaces
+func normalizeForMatch(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+}
+
+// matchesAllKeywords returns true if every word in keywords appears in s
+func matchesAllKeywords(keywords, s string) bool {
+	normalized := normalizeForMatch(s)
+	for _, word := range strings.Fields(normalizeForMatch(keywords)) {
+		if !strings.Contains(normalized, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// rowFilterAndMatch keeps only rows where the title contains all of the query keywords
+func rowFilterAndMatch(rows []searchRow, ctx rowFilterContext) []searchRow {
+	keywords := ctx.Keywords
+	if strings.TrimSpace(keywords) == "" {
+		return rows
+	}
+
+	filtered := []searchRow{}
+	for _, row := range rows {
+		title, ok := ctx.fieldText("title", row)
+		if !ok {
+			title = row.Text()
+		}
+
+		if !matchesAllKeywords(keywords, title) {
+			filterLogger.
+				WithFields(logrus.Fields{"title": title, "keywords": keywords}).
+				Debug("Row doesn't match all keywords, skipping")
+			continue
+		}
+
+		filtered = append(filtered, row)
+	}
+
+	return filtered
+}
+
+// rowFilterLimit keeps only the first limit rows
+func rowFilterLimit(limit int, rows []searchRow) []searchRow {
+	if len(rows) <= limit {
+		return rows
+	}
+	return rows[:limit]
+}
+
+// rowFilterDedupe removes rows with the same value for a field, or the same text if no field is given
+func rowFilterDedupe(field string, rows []searchRow, ctx rowFilterContext) []searchRow {
+	seen := map[string]bool{}
+	filtered := []searchRow{}
+
+	for _, row := range rows {
+		key, ok := ctx.fieldText(field, row)
+		if !ok {
+			key = normalizeSpace(row.Text())
+		}
+
+		if seen[key] {
+			filterLogger.
+				WithFields(logrus.Fields{"key": key}).
+				Debug("Skipping duplicate row")
+			continue
+		}
+
+		seen[key] = true
+		filtered = append(filtered, row)
+	}
+
+	return filtered
+}
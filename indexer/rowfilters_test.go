@@ -0,0 +1,93 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/cardigann/cardigann/torznab"
+)
+
+const exampleRowsPage = `
+<table>
+  <tr><td><a>Llama Llama S01E01</a></td><td>1</td></tr>
+  <tr><td><a>Alpaca Adventures S01E01</a></td><td>2</td></tr>
+  <tr><td><a>llama.llama.s01e02</a></td><td>3</td></tr>
+  <tr><td><a>Llama Llama S01E01</a></td><td>4</td></tr>
+</table>
+`
+
+func exampleRows(t *testing.T) []searchRow {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(exampleRowsPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return htmlRows(doc.Find("tr"))
+}
+
+func TestRowFilters(t *testing.T) {
+	ctx := rowFilterContext{
+		Query:    torznab.Query{Q: "llama llama"},
+		Keywords: "llama llama",
+		Fields: fieldsListBlock{
+			{Field: "title", Block: selectorBlock{Selector: "td:nth-child(1) a"}},
+		},
+	}
+
+	for idx, example := range []struct {
+		name     string
+		args     interface{}
+		expected []string
+	}{
+		{"andmatch", nil, []string{"1", "3", "4"}},
+		{"limit", 2, []string{"1", "2"}},
+		{"limit", 10, []string{"1", "2", "3", "4"}},
+		{"dedupe", "title", []string{"1", "2", "3"}},
+		{"dedupe", nil, []string{"1", "2", "3", "4"}},
+	} {
+		rows, err := invokeRowFilter(example.name, example.args, exampleRows(t), ctx)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		result := []string{}
+		for _, row := range rows {
+			result = append(result, row.(htmlRow).Find("td:nth-child(2)").Text())
+		}
+		if strings.Join(result, ",") != strings.Join(example.expected, ",") {
+			t.Fatalf("Row #%d was expecting rows %v, got %v", idx+1, example.expected, result)
+		}
+	}
+}
+
+func TestRowFiltersInvalidArgs(t *testing.T) {
+	for idx, example := range []struct {
+		name string
+		args interface{}
+	}{
+		{"andmatch", "llamas"},
+		{"limit", "llamas"},
+		{"limit", -1},
+		{"dedupe", 1},
+		{"llamas", nil},
+	} {
+		if _, err := invokeRowFilter(example.name, example.args, exampleRows(t), rowFilterContext{}); err == nil {
+			t.Fatalf("Row #%d expected an error", idx+1)
+		}
+	}
+}
+
+func TestMatchesAllKeywords(t *testing.T) {
+	for idx, example := range []struct {
+		keywords, title string
+		expected        bool
+	}{
+		{"llama llama", "Llama.Llama.S01E01", true},
+		{"Llama S01E01", "llama llama s01e01 720p", true},
+		{"llama alpaca", "Llama Llama S01E01", false},
+		{"", "Anything", true},
+	} {
+		if result := matchesAllKeywords(example.keywords, example.title); result != example.expected {
+			t.Fatalf("Row #%d was expecting %v, got %v", idx+1, example.expected, result)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package indexer
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	responseTypeHTML = "html"
+	responseTypeJSON = "json"
+	responseTypeXML  = "xml"
+)
+
+type responseBlock struct {
+	Type string `yaml:"type"`
+}
+
+// searchRow is a single search result that fields are extracted from
+type searchRow interface {
+	// MatchText extracts the text for a selectorBlock relative to the row
+	MatchText(block selectorBlock) (string, error)
+
+	// Text returns all of the text in the row
+	Text() string
+
+	// Clone returns a copy of the row that can be matched without side effects
+	Clone() searchRow
+}
+
+type htmlRow struct {
+	*goquery.Selection
+}
+
+func (r htmlRow) MatchText(block selectorBlock) (string, error) {
+	return block.MatchText(r.Selection)
+}
+
+func (r htmlRow) Text() string {
+	return strings.TrimSpace(r.Selection.Text())
+}
+
+func (r htmlRow) Clone() searchRow {
+	return htmlRow{r.Selection.Clone()}
+}
+
+// htmlRows wraps each element of a selection as a searchRow
+func htmlRows(sel *goquery.Selection) []searchRow {
+	rows := []searchRow{}
+	sel.Each(func(i int, s *goquery.Selection) {
+		rows = append(rows, htmlRow{s})
+	})
+	return rows
+}
@@ -17,6 +17,7 @@ import (
 	"sync"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/proxy"
 
@@ -27,7 +28,6 @@ import (
 	"github.com/cardigann/cardigann/torznab"
 	imdbscraper "github.com/cardigann/go-imdb-scraper"
 	"github.com/cardigann/releaseinfo"
-	"github.com/dustin/go-humanize"
 	"github.com/f2prateek/train"
 	trainlog "github.com/f2prateek/train/log"
 	"github.com/headzoo/surf"
@@ -52,6 +52,9 @@ type Runner struct {
 	definition  *IndexerDefinition
 	browser     browser.Browsable
 	cookies     http.CookieJar
+	headers     *headerTransport
+	charset     *charsetTransport
+	transport   http.RoundTripper
 	opts        RunnerOpts
 	logger      logrus.FieldLogger
 	caps        torznab.Capabilities
@@ -124,22 +127,41 @@ func (r *Runner) createBrowser() {
 		transport = r.opts.Transport
 	}
 
+	configURL, _, _ := r.opts.Config.Get(r.definition.Site, "url")
+
+	r.headers = &headerTransport{
+		RoundTripper: transport,
+		Hosts:        hostsForLinks(append([]string{configURL}, r.definition.Links...)...),
+	}
+
+	r.charset = &charsetTransport{
+		RoundTripper: r.headers,
+		Encoding:     r.definition.Encoding,
+		Logger:       r.logger,
+	}
+	transport = r.charset
+
 	switch os.Getenv("DEBUG_HTTP") {
 	case "1", "true", "basic":
-		bow.SetTransport(train.TransportWith(transport, trainlog.New(os.Stderr, trainlog.Basic)))
+		transport = train.TransportWith(transport, trainlog.New(os.Stderr, trainlog.Basic))
 	case "body":
-		bow.SetTransport(train.TransportWith(transport, trainlog.New(os.Stderr, trainlog.Body)))
+		transport = train.TransportWith(transport, trainlog.New(os.Stderr, trainlog.Body))
 	case "":
-		bow.SetTransport(transport)
 	default:
 		panic("Unknown value for DEBUG_HTTP")
 	}
 
+	bow.SetTransport(transport)
+
 	r.browser = bow
+	r.transport = transport
 }
 
 func (r *Runner) releaseBrowser() {
 	r.browser = nil
+	r.headers = nil
+	r.charset = nil
+	r.transport = nil
 	r.browserLock.Unlock()
 }
 
@@ -150,18 +172,34 @@ func (r *Runner) checkHasConfig() error {
 		if err != nil {
 			return fmt.Errorf("Error reading config for %s: %v", setting.Name, err)
 		}
-		if !ok {
+		if !ok && !setting.Optional() {
 			return fmt.Errorf("No value for %s.%s in config", r.definition.Site, setting.Name)
 		}
 	}
 	return nil
 }
 
-func (r *Runner) applyTemplate(name, tpl string, ctx interface{}) (string, error) {
-	funcMap := template.FuncMap{
-		"replace": strings.Replace,
+// templateConfig returns the indexer's config for use in templates as .Config, with the default
+// values of any settings that aren't configured
+func (r *Runner) templateConfig() (map[string]string, error) {
+	section, err := r.opts.Config.Section(r.definition.Site)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := map[string]string{}
+	for _, setting := range r.definition.Settings {
+		cfg[setting.Name] = setting.DefaultValue()
 	}
-	tmpl, err := template.New(name).Funcs(funcMap).Parse(tpl)
+	for k, v := range section {
+		cfg[k] = v
+	}
+
+	return cfg, nil
+}
+
+func (r *Runner) applyTemplate(name, tpl string, ctx interface{}) (string, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(tpl)
 	if err != nil {
 		return "", err
 	}
@@ -178,6 +216,24 @@ func (r *Runner) applyTemplate(name, tpl string, ctx interface{}) (string, error
 	return b.String(), nil
 }
 
+// encodeValues converts input values into the charset the site expects
+func (r *Runner) encodeValues(vals url.Values) (url.Values, error) {
+	enc, err := lookupEncoding(r.definition.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	return encodeValues(enc, vals)
+}
+
+// encodeURL converts a templated url into the charset the site expects
+func (r *Runner) encodeURL(u string) (string, error) {
+	enc, err := lookupEncoding(r.definition.Encoding)
+	if err != nil {
+		return "", err
+	}
+	return encodeURL(enc, u)
+}
+
 func (r *Runner) currentURL() (*url.URL, error) {
 	if u := r.browser.Url(); u != nil {
 		return u, nil
@@ -350,7 +406,16 @@ func (r *Runner) loginViaForm(loginURL, formSelector string, vals map[string]str
 		return err
 	}
 
+	enc, err := lookupEncoding(r.definition.Encoding)
+	if err != nil {
+		return err
+	}
+
 	for name, value := range vals {
+		if value, err = encodeString(enc, value); err != nil {
+			return err
+		}
+
 		r.logger.
 			WithFields(logrus.Fields{"key": name, "form": formSelector, "val": value}).
 			Debugf("Filling input of form")
@@ -376,13 +441,43 @@ func (r *Runner) loginViaForm(loginURL, formSelector string, vals map[string]str
 	return nil
 }
 
-func (r *Runner) loginViaPost(loginURL string, vals map[string]string) error {
-	data := url.Values{}
-	for key, value := range vals {
-		data.Add(key, value)
+// requestWithValues makes a GET request with vals added to the query of u, or a POST request with
+// vals as the form body, vals are encoded in the charset the site expects
+func (r *Runner) requestWithValues(method, u string, vals map[string]string) error {
+	switch method {
+	case http.MethodGet:
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return err
+		}
+
+		data := parsed.Query()
+		for key, value := range vals {
+			data.Add(key, value)
+		}
+
+		if data, err = r.encodeValues(data); err != nil {
+			return err
+		}
+
+		parsed.RawQuery = data.Encode()
+		return r.openPage(parsed.String())
+
+	case http.MethodPost:
+		data := url.Values{}
+		for key, value := range vals {
+			data.Add(key, value)
+		}
+
+		data, err := r.encodeValues(data)
+		if err != nil {
+			return err
+		}
+
+		return r.postToPage(u, data)
 	}
 
-	return r.postToPage(loginURL, data)
+	return fmt.Errorf("Unsupported request method %q", method)
 }
 
 func parseCookieString(cookie string) []*http.Cookie {
@@ -403,19 +498,41 @@ func (r *Runner) loginViaCookie(loginURL string, cookie string) error {
 		WithFields(logrus.Fields{"url": loginURL, "cookies": cookies}).
 		Debugf("Setting cookies for login")
 
-	cj := jar.NewMemoryCookies()
-	cj.SetCookies(u, cookies)
+	r.cookies.SetCookies(u, cookies)
+	return nil
+}
+
+func (r *Runner) loginViaHeader(vals map[string]string) error {
+	for name, value := range vals {
+		r.logger.
+			WithFields(logrus.Fields{"header": name}).
+			Debugf("Setting header for login")
+
+		r.headers.SetHeader(name, value)
+	}
+	return nil
+}
+
+func (r *Runner) loginViaAPIKey(vals map[string]string) error {
+	for name, value := range vals {
+		r.logger.
+			WithFields(logrus.Fields{"param": name}).
+			Debugf("Setting query parameter for login")
 
-	r.browser.SetCookieJar(cj)
+		r.headers.SetQuery(name, value)
+	}
 	return nil
 }
 
-func (r *Runner) extractInputLogins() (map[string]string, error) {
-	result := map[string]string{}
+// applyHeaders sets the headers from a headers block on all subsequent requests
+func (r *Runner) applyHeaders(headers inputsBlock) error {
+	if len(headers) == 0 {
+		return nil
+	}
 
-	cfg, err := r.opts.Config.Section(r.definition.Site)
+	cfg, err := r.templateConfig()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	ctx := struct {
@@ -424,7 +541,91 @@ func (r *Runner) extractInputLogins() (map[string]string, error) {
 		cfg,
 	}
 
-	for name, val := range r.definition.Login.Inputs {
+	for name, val := range headers {
+		resolved, err := r.applyTemplate("headers", val, ctx)
+		if err != nil {
+			return err
+		}
+		r.headers.SetHeader(name, resolved)
+	}
+
+	return nil
+}
+
+// applyRequestHeaders sets the login credentials that are sent as headers or query parameters and
+// a headers block before the first request is made, so that every request to the indexer has them
+func (r *Runner) applyRequestHeaders(headers inputsBlock) error {
+	if err := r.applyLoginHeaders(); err != nil {
+		return err
+	}
+	return r.applyHeaders(headers)
+}
+
+// applyLoginHeaders sets the credentials of header and apikey login steps, which don't depend on
+// a page being loaded
+func (r *Runner) applyLoginHeaders() error {
+	for _, step := range r.definition.Login.loginSteps() {
+		if step.Method != loginMethodHeader && step.Method != loginMethodAPIKey {
+			continue
+		}
+
+		cfg, err := r.templateConfig()
+		if err != nil {
+			return err
+		}
+
+		vals, err := r.extractInputLogins(step.Inputs, loginTemplateCtx{Config: cfg, Inputs: map[string]string{}})
+		if err != nil {
+			return err
+		}
+
+		if step.Method == loginMethodHeader {
+			err = r.loginViaHeader(vals)
+		} else {
+			err = r.loginViaAPIKey(vals)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loginTemplateCtx is the context for login templates, Inputs contains the named inputs on the
+// page loaded by the previous login step, e.g hidden csrf tokens
+type loginTemplateCtx struct {
+	Config map[string]string
+	Inputs map[string]string
+}
+
+func (r *Runner) loginTemplateCtx() (loginTemplateCtx, error) {
+	cfg, err := r.templateConfig()
+	if err != nil {
+		return loginTemplateCtx{}, err
+	}
+
+	ctx := loginTemplateCtx{
+		Config: cfg,
+		Inputs: map[string]string{},
+	}
+
+	if r.browser.Url() != nil {
+		r.browser.Find("input[name]").Each(func(i int, s *goquery.Selection) {
+			name, _ := s.Attr("name")
+			if _, exists := ctx.Inputs[name]; !exists {
+				ctx.Inputs[name], _ = s.Attr("value")
+			}
+		})
+	}
+
+	return ctx, nil
+}
+
+func (r *Runner) extractInputLogins(inputs inputsBlock, ctx loginTemplateCtx) (map[string]string, error) {
+	result := map[string]string{}
+
+	for name, val := range inputs {
 		resolved, err := r.applyTemplate("login_inputs", val, ctx)
 		if err != nil {
 			return nil, err
@@ -511,52 +712,97 @@ func (r *Runner) login() error {
 	if r.browser == nil {
 		r.createBrowser()
 		defer r.releaseBrowser()
+
+		if err := r.applyLoginHeaders(); err != nil {
+			return err
+		}
 	}
 
 	filterLogger = r.logger
 
-	loginUrl, err := r.resolvePath(r.definition.Login.Path)
+	for idx, step := range r.definition.Login.loginSteps() {
+		r.logger.
+			WithFields(logrus.Fields{"step": idx + 1, "method": step.Method, "path": step.Path}).
+			Debugf("Running login step")
+
+		if err := r.loginStep(step); err != nil {
+			return err
+		}
+	}
+
+	if len(r.definition.Login.Error) > 0 {
+		if err := r.definition.Login.hasError(r.browser); err != nil {
+			r.logger.WithError(err).Error("Failed to login")
+			return err
+		}
+	}
+
+	match, err := r.matchPageTestBlock(r.definition.Login.Test)
+	if err != nil {
+		return err
+	} else if !match {
+		return errors.New("Login check after login failed")
+	}
+
+	r.logger.Debug("Successfully logged in")
+	return nil
+}
+
+func (r *Runner) loginStep(step loginStepBlock) error {
+	ctx, err := r.loginTemplateCtx()
+	if err != nil {
+		return err
+	}
+
+	loginPath, err := r.applyTemplate("login_path", step.Path, ctx)
+	if err != nil {
+		return err
+	}
+
+	loginUrl, err := r.resolvePath(loginPath)
 	if err != nil {
 		return err
 	}
 
-	vals, err := r.extractInputLogins()
+	vals, err := r.extractInputLogins(step.Inputs, ctx)
 	if err != nil {
 		return err
 	}
 
-	switch r.definition.Login.Method {
+	switch step.Method {
 	case "", loginMethodForm:
-		if err = r.loginViaForm(loginUrl, r.definition.Login.FormSelector, vals); err != nil {
+		if err = r.loginViaForm(loginUrl, step.FormSelector, vals); err != nil {
 			return err
 		}
 	case loginMethodPost:
-		if err = r.loginViaPost(loginUrl, vals); err != nil {
+		if err = r.requestWithValues(http.MethodPost, loginUrl, vals); err != nil {
+			return err
+		}
+	case loginMethodGet:
+		if err = r.requestWithValues(http.MethodGet, loginUrl, vals); err != nil {
 			return err
 		}
 	case loginMethodCookie:
 		if err = r.loginViaCookie(loginUrl, vals["cookie"]); err != nil {
 			return err
 		}
-	default:
-		return fmt.Errorf("Unknown login method %q", r.definition.Login.Method)
-	}
-
-	if len(r.definition.Login.Error) > 0 {
-		if err = r.definition.Login.hasError(r.browser); err != nil {
-			r.logger.WithError(err).Error("Failed to login")
+	case loginMethodHeader:
+		if err = r.loginViaHeader(vals); err != nil {
 			return err
 		}
+	case loginMethodAPIKey:
+		if err = r.loginViaAPIKey(vals); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown login method %q", step.Method)
 	}
 
-	match, err := r.matchPageTestBlock(r.definition.Login.Test)
-	if err != nil {
+	if err = step.Error.hasError(r.browser); err != nil {
+		r.logger.WithError(err).Error("Failed to login")
 		return err
-	} else if !match {
-		return errors.New("Login check after login failed")
 	}
 
-	r.logger.Debug("Successfully logged in")
 	return nil
 }
 
@@ -597,6 +843,8 @@ func (r *Runner) Capabilities() torznab.Capabilities {
 type extractedItem struct {
 	torznab.ResultItem
 	LocalCategoryID string
+	DetailsURL      string
+	Leechers        int
 }
 
 // localCategories returns a slice of local categories that should be searched
@@ -679,6 +927,23 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 	// TODO: make this concurrency safe
 	filterLogger = r.logger
 
+	keywords, err := r.filterKeywords(query.Keywords())
+	if err != nil {
+		return nil, err
+	}
+
+	// sites that reject short searches would return an error page rather than no results
+	if min := r.definition.Search.KeywordsMinLength; keywords != "" && utf8.RuneCountInString(keywords) < min {
+		r.logger.
+			WithFields(logrus.Fields{"keywords": keywords, "min": min}).
+			Info("Keywords are shorter than the minimum length, skipping search")
+		return []torznab.ResultItem{}, nil
+	}
+
+	if err = r.applyRequestHeaders(r.definition.Search.Headers); err != nil {
+		return nil, err
+	}
+
 	if required, err := r.isLoginRequired(); err != nil {
 		return nil, err
 	} else if required {
@@ -691,123 +956,287 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 	localCats := r.localCategories(query)
 
 	r.logger.Debugf("Query is %v", query)
-	r.logger.Debugf("Keywords are %q", query.Keywords())
-
-	templateCtx := struct {
-		Query      torznab.Query
-		Keywords   string
-		Categories []string
-	}{
-		query,
-		query.Keywords(),
-		localCats,
-	}
+	r.logger.Debugf("Keywords are %q", keywords)
 
-	searchURL, err := r.applyTemplate("search_path", r.definition.Search.Path, templateCtx)
+	cfg, err := r.templateConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	searchURL, err = r.resolvePath(searchURL)
-	if err != nil {
-		return nil, err
+	templateCtx := searchTemplateCtx{
+		Config:     cfg,
+		Query:      query,
+		Keywords:   keywords,
+		Categories: localCats,
 	}
 
 	r.logger.
 		WithFields(logrus.Fields{"query": query.Encode()}).
 		Infof("Searching indexer")
 
-	vals := url.Values{}
+	timer := time.Now()
+	extracted := []extractedItem{}
+	seen := map[string]bool{}
 
-	for name, val := range r.definition.Search.Inputs {
-		resolved, err := r.applyTemplate("search_inputs", val, templateCtx)
+	for _, path := range r.definition.Search.searchPaths() {
+		if !path.matchesQuery(query) {
+			r.logger.
+				WithFields(logrus.Fields{"path": path.Path, "modes": path.Modes, "categories": path.Categories}).
+				Debug("Skipping search path that doesn't match query")
+			continue
+		}
+
+		items, err := r.searchPath(path, query, templateCtx, localCats)
 		if err != nil {
 			return nil, err
 		}
-		switch name {
-		case "$raw":
-			parsedVals, err := url.ParseQuery(resolved)
-			if err != nil {
-				r.logger.WithError(err).Warn(err)
-				return nil, fmt.Errorf("Error parsing $raw input: %s", err.Error())
-			}
-
-			r.logger.
-				WithFields(logrus.Fields{"source": val, "parsed": parsedVals}).
-				Debugf("Processed $raw input")
 
-			for k, values := range parsedVals {
-				for _, val := range values {
-					vals.Add(k, val)
-				}
+		// skip items that were already returned by a previous path
+		for _, item := range items {
+			if !seen[item.GUID] {
+				extracted = append(extracted, item)
+			}
+		}
+		for _, item := range items {
+			if item.GUID != "" {
+				seen[item.GUID] = true
 			}
-		default:
-			vals.Add(name, resolved)
 		}
 	}
 
-	timer := time.Now()
-
-	switch r.definition.Search.Method {
-	case "", searchMethodGet:
-		if len(vals) > 0 {
-			searchURL = fmt.Sprintf("%s?%s", searchURL, vals.Encode())
-		}
-		if err = r.openPage(searchURL); err != nil {
-			return nil, err
-		}
-	case searchMethodPost:
-		if err = r.postToPage(searchURL, vals); err != nil {
-			return nil, err
+	if query.Offset > 0 {
+		if query.Offset >= len(extracted) {
+			extracted = []extractedItem{}
+		} else {
+			extracted = extracted[query.Offset:]
 		}
+	}
 
-	default:
-		return nil, fmt.Errorf("Unknown search method %q", r.definition.Search.Method)
+	if query.Limit > 0 && len(extracted) > query.Limit {
+		extracted = extracted[:query.Limit]
 	}
 
-	dom := r.browser.Dom()
+	if !r.definition.Search.Details.IsEmpty() {
+		r.enrichFromDetails(extracted, templateCtx)
+	}
 
-	// merge following rows for After selector
-	if after := r.definition.Search.Rows.After; after > 0 {
-		rows := dom.Find(r.definition.Search.Rows.Selector)
-		for i := 0; i < rows.Length(); i += 1 + after {
-			rows.Eq(i).AppendSelection(rows.Slice(i+1, i+1+after).Find("td"))
-			rows.Slice(i+1, i+1+after).Remove()
-		}
+	r.logger.
+		WithFields(logrus.Fields{"time": time.Now().Sub(timer)}).
+		Infof("Query returned %d results", len(extracted))
+
+	items := []torznab.ResultItem{}
+	for _, item := range extracted {
+		items = append(items, item.ResultItem)
 	}
 
-	// apply Remove if it exists
-	if remove := r.definition.Search.Rows.Remove; remove != "" {
-		matching := dom.Find(r.definition.Search.Rows.Selector).Filter(remove)
+	return items, nil
+}
+
+// filterKeywords applies the keywords filters to the query keywords before they are templated
+func (r *Runner) filterKeywords(keywords string) (string, error) {
+	for _, f := range r.definition.Search.KeywordsFilters {
 		r.logger.
-			WithFields(logrus.Fields{"selector": remove}).
-			Debugf("Applying remove to %d rows", matching.Length())
-		matching.Remove()
+			WithFields(logrus.Fields{"args": f.Args, "before": keywords}).
+			Debugf("Applying keywords filter %s", f.Name)
+
+		var err error
+		keywords, err = invokeFilter(f.Name, f.Args, keywords)
+		if err != nil {
+			return "", fmt.Errorf("Error applying keywords filter %s: %v", f.Name, err)
+		}
 	}
 
-	rows := dom.Find(r.definition.Search.Rows.Selector)
+	return keywords, nil
+}
 
-	r.logger.
-		WithFields(logrus.Fields{
-			"rows":     rows.Length(),
-			"selector": r.definition.Search.Rows.Selector,
-			"limit":    query.Limit,
-			"offset":   query.Offset,
-		}).Debugf("Found %d rows", rows.Length())
+// searchTemplateCtx is the context that search paths and inputs are templated with
+type searchTemplateCtx struct {
+	Config     map[string]string
+	Query      torznab.Query
+	Keywords   string
+	Categories []string
+	Page       int
+}
 
+// searchPath requests a search path and any further pages, returning the items extracted
+func (r *Runner) searchPath(path searchPath, query torznab.Query, templateCtx searchTemplateCtx, localCats []string) ([]extractedItem, error) {
+	paging := r.definition.Search.Paging
 	extracted := []extractedItem{}
+	seen := map[string]bool{}
 
-	for i := 0; i < rows.Length(); i++ {
-		if query.Limit > 0 && len(extracted) >= query.Limit {
-			break
+	for page := 0; page < paging.maxPages(); page++ {
+		if page == 0 || paging.Next.IsEmpty() {
+			templateCtx.Page = paging.Start + page
+			if err := r.openSearchPage(path, templateCtx); err != nil {
+				return nil, err
+			}
+		} else {
+			nextURL, err := r.matchResponse(paging.Next)
+			if err != nil || nextURL == "" {
+				r.logger.WithError(err).Debug("No next page found, stopping")
+				break
+			}
+			if nextURL, err = r.resolvePath(nextURL); err != nil {
+				return nil, err
+			}
+			if err = r.openPage(nextURL); err != nil {
+				return nil, err
+			}
 		}
 
-		item, err := r.extractItem(i+1, rows.Eq(i))
-		if err != nil {
+		if err := r.definition.Search.Error.hasError(r.browser); err != nil {
+			r.logger.WithError(err).Error("Search failed")
 			return nil, err
 		}
 
-		var matchCat bool
+		rows, err := r.searchRows()
+		if err != nil {
+			return nil, err
+		}
+
+		r.logger.
+			WithFields(logrus.Fields{
+				"rows":     len(rows),
+				"selector": r.definition.Search.Rows.String(),
+				"page":     page + 1,
+				"limit":    query.Limit,
+				"offset":   query.Offset,
+			}).Debugf("Found %d rows", len(rows))
+
+		if len(rows) == 0 {
+			if page == 0 {
+				if err = r.checkNoResults(); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+
+		rows, err = r.filterRows(rows, templateCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := r.processRows(rows, templateCtx, localCats, len(extracted))
+		if err != nil {
+			return nil, err
+		}
+
+		// trackers that ignore the page return the same rows again
+		added := 0
+		for _, item := range items {
+			if item.GUID == "" || !seen[item.GUID] {
+				extracted = append(extracted, item)
+				added++
+			}
+			seen[item.GUID] = true
+		}
+		if len(items) > 0 && added == 0 {
+			r.logger.
+				WithFields(logrus.Fields{"page": page + 1}).
+				Debug("Page had no new results, stopping")
+			break
+		}
+
+		if query.Limit > 0 && len(extracted) >= query.Offset+query.Limit {
+			break
+		}
+	}
+
+	return extracted, nil
+}
+
+// openSearchPage resolves the search path and inputs and requests the search page
+func (r *Runner) openSearchPage(path searchPath, templateCtx searchTemplateCtx) error {
+	searchURL, err := r.applyTemplate("search_path", path.Path, templateCtx)
+	if err != nil {
+		return err
+	}
+
+	searchURL, err = r.resolvePath(searchURL)
+	if err != nil {
+		return err
+	}
+
+	if searchURL, err = r.encodeURL(searchURL); err != nil {
+		return err
+	}
+
+	inputs := inputsBlock{}
+	for name, val := range r.definition.Search.Inputs {
+		inputs[name] = val
+	}
+	for name, val := range path.Inputs {
+		inputs[name] = val
+	}
+
+	vals := url.Values{}
+
+	for name, val := range inputs {
+		resolved, err := r.applyTemplate("search_inputs", val, templateCtx)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "$raw":
+			parsedVals, err := url.ParseQuery(resolved)
+			if err != nil {
+				r.logger.WithError(err).Warn(err)
+				return fmt.Errorf("Error parsing $raw input: %s", err.Error())
+			}
+
+			r.logger.
+				WithFields(logrus.Fields{"source": val, "parsed": parsedVals}).
+				Debugf("Processed $raw input")
+
+			for k, values := range parsedVals {
+				for _, val := range values {
+					vals.Add(k, val)
+				}
+			}
+		default:
+			vals.Add(name, resolved)
+		}
+	}
+
+	if input := r.definition.Search.Paging.Input; input != "" {
+		vals.Set(input, strconv.Itoa(templateCtx.Page))
+	}
+
+	vals, err = r.encodeValues(vals)
+	if err != nil {
+		return err
+	}
+
+	switch path.Method {
+	case "", searchMethodGet:
+		if len(vals) > 0 {
+			searchURL = fmt.Sprintf("%s?%s", searchURL, vals.Encode())
+		}
+		return r.openPage(searchURL)
+	case searchMethodPost:
+		return r.postToPage(searchURL, vals)
+	}
+
+	return fmt.Errorf("Unknown search method %q", path.Method)
+}
+
+// processRows extracts items from rows and drops the ones that don't match the query
+func (r *Runner) processRows(rows []searchRow, templateCtx searchTemplateCtx, localCats []string, offset int) ([]extractedItem, error) {
+	extracted := []extractedItem{}
+	query := templateCtx.Query
+
+	for i, row := range rows {
+		if query.Limit > 0 && offset+len(extracted) >= query.Offset+query.Limit {
+			break
+		}
+
+		item, err := r.extractItem(offset+i+1, row, templateCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		var matchCat bool
 		if len(localCats) > 0 {
 			for _, catId := range localCats {
 				if catId == item.LocalCategoryID {
@@ -856,39 +1285,272 @@ func (r *Runner) Search(query torznab.Query) ([]torznab.ResultItem, error) {
 		extracted = append(extracted, item)
 	}
 
-	r.logger.
-		WithFields(logrus.Fields{"time": time.Now().Sub(timer)}).
-		Infof("Query returned %d results", len(extracted))
+	return extracted, nil
+}
 
-	items := []torznab.ResultItem{}
-	for _, item := range extracted {
-		items = append(items, item.ResultItem)
+// responseBody returns the raw body of the current page
+func (r *Runner) responseBody() ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := r.browser.Download(&b); err != nil {
+		return nil, err
 	}
+	return b.Bytes(), nil
+}
 
-	return items, nil
+// searchBody returns the body of the current page with the search preprocessing filters applied
+func (r *Runner) searchBody() ([]byte, error) {
+	body, err := r.responseBody()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := string(body)
+	for _, f := range r.definition.Search.PreprocessingFilters {
+		r.logger.
+			WithFields(logrus.Fields{"args": f.Args, "length": len(filtered)}).
+			Debugf("Applying preprocessing filter %s", f.Name)
+
+		if filtered, err = invokeFilterWithLocale(f.Name, f.Args, filtered, r.definition.Location(), r.definition.numberFormat()); err != nil {
+			return nil, fmt.Errorf("Preprocessing filter %s failed: %v", f.Name, err)
+		}
+	}
+
+	return []byte(filtered), nil
 }
 
-func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extractedItem, error) {
-	row := map[string]string{}
+// searchDom returns the dom of the current page, which is parsed from the preprocessed body when
+// there are preprocessing filters
+func (r *Runner) searchDom() (*goquery.Selection, error) {
+	if len(r.definition.Search.PreprocessingFilters) == 0 {
+		return r.browser.Dom(), nil
+	}
 
-	html, _ := goquery.OuterHtml(selection)
-	r.logger.WithFields(logrus.Fields{"html": gohtml.Format(html)}).Debug("Processing row")
+	body, err := r.searchBody()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, item := range r.definition.Search.Fields {
-		r.logger.
-			WithFields(logrus.Fields{"row": rowIdx, "block": item.Block.String()}).
-			Debugf("Processing field %q", item.Field)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.Selection, nil
+}
 
-		val, err := item.Block.MatchText(selection)
+// responseDocument parses the current page based on the response type and returns it as a single row
+func (r *Runner) responseDocument() (searchRow, error) {
+	switch r.definition.Search.Response.Type {
+	case "", responseTypeHTML:
+		dom, err := r.searchDom()
 		if err != nil {
-			return extractedItem{}, err
+			return nil, err
+		}
+		return htmlRow{dom}, nil
+
+	case responseTypeJSON:
+		body, err := r.searchBody()
+		if err != nil {
+			return nil, err
+		}
+		doc, err := parseJSONDocument(body)
+		if err != nil {
+			return nil, err
+		}
+		return jsonRow{doc}, nil
+
+	case responseTypeXML:
+		body, err := r.searchBody()
+		if err != nil {
+			return nil, err
+		}
+		doc, err := parseXMLDocument(body)
+		if err != nil {
+			return nil, err
+		}
+		return xmlRow{htmlRow{doc.Selection}}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown response type %q", r.definition.Search.Response.Type)
+}
+
+// checkNoResults is called when the first page of a search has no rows. If the definition has a
+// noresults check that doesn't match the page then the rows selector is assumed to be out of date
+func (r *Runner) checkNoResults() error {
+	noResults := r.definition.Search.NoResults
+	if noResults.IsEmpty() {
+		r.logger.Debug("Search returned no rows and the definition has no noresults check")
+		return nil
+	}
+
+	// preprocessing filters can strip the message, so the text is checked in the raw body
+	if noResults.Text != "" {
+		body, err := r.responseBody()
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(body), noResults.Text) {
+			r.logger.Debug("Search page matched noresults text")
+			return nil
+		}
+	}
+
+	if noResults.Selector != "" {
+		if _, err := r.matchResponse(selectorBlock{Selector: noResults.Selector}); err == nil {
+			r.logger.Debug("Search page matched noresults selector")
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"No rows matched %q and the page isn't a no results page, the definition appears broken",
+		strings.Join(r.definition.Search.Rows.selectorList(), ", "))
+}
+
+// matchResponse extracts the text for a selectorBlock from the current page
+func (r *Runner) matchResponse(block selectorBlock) (string, error) {
+	doc, err := r.responseDocument()
+	if err != nil {
+		return "", err
+	}
+	return doc.MatchText(block)
+}
+
+// searchRows parses the current page based on the response type and returns the matching rows
+func (r *Runner) searchRows() ([]searchRow, error) {
+	switch r.definition.Search.Response.Type {
+	case "", responseTypeHTML:
+		dom, err := r.searchDom()
+		if err != nil {
+			return nil, err
 		}
+		return r.htmlSearchRows(dom), nil
 
+	case responseTypeJSON:
+		body, err := r.searchBody()
+		if err != nil {
+			return nil, err
+		}
+		return r.jsonSearchRows(body)
+
+	case responseTypeXML:
+		body, err := r.searchBody()
+		if err != nil {
+			return nil, err
+		}
+		return parseXMLRows(body, r.definition.Search.Rows)
+	}
+
+	return nil, fmt.Errorf("Unknown response type %q", r.definition.Search.Response.Type)
+}
+
+// jsonSearchRows returns the rows of the first rows selector that matches any
+func (r *Runner) jsonSearchRows(body []byte) ([]searchRow, error) {
+	rows := []searchRow{}
+	for _, sel := range r.definition.Search.Rows.selectorList() {
+		var err error
+		if rows, err = parseJSONRows(body, sel); err != nil || len(rows) > 0 {
+			return rows, err
+		}
+	}
+	return rows, nil
+}
+
+func (r *Runner) htmlSearchRows(dom *goquery.Selection) []searchRow {
+	selector := r.definition.Search.Rows.firstMatching(func(sel string) bool {
+		return dom.Find(sel).Length() > 0
+	})
+
+	// merge following rows for After selector
+	if after := r.definition.Search.Rows.After; after > 0 {
+		rows := dom.Find(selector)
+		for i := 0; i < rows.Length(); i += 1 + after {
+			rows.Eq(i).AppendSelection(rows.Slice(i+1, i+1+after).Find("td"))
+			rows.Slice(i+1, i+1+after).Remove()
+		}
+	}
+
+	// apply Remove if it exists
+	if remove := r.definition.Search.Rows.Remove; remove != "" {
+		matching := dom.Find(selector).Filter(remove)
 		r.logger.
-			WithFields(logrus.Fields{"row": rowIdx, "output": val}).
-			Debugf("Finished processing field %q", item.Field)
+			WithFields(logrus.Fields{"selector": remove}).
+			Debugf("Applying remove to %d rows", matching.Length())
+		matching.Remove()
+	}
+
+	return htmlRows(dom.Find(selector))
+}
+
+// filterRows applies the row filters to the matched rows before any fields are extracted
+func (r *Runner) filterRows(rows []searchRow, templateCtx searchTemplateCtx) ([]searchRow, error) {
+	ctx := rowFilterContext{
+		Query:    templateCtx.Query,
+		Keywords: templateCtx.Keywords,
+		Fields:   r.definition.Search.Fields,
+	}
+
+	for _, f := range r.definition.Search.Rows.Filters {
+		r.logger.
+			WithFields(logrus.Fields{"args": f.Args, "rows": len(rows)}).
+			Debugf("Applying row filter %s", f.Name)
+
+		var err error
+		rows, err = invokeRowFilter(f.Name, f.Args, rows, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		row[item.Field] = val
+	return rows, nil
+}
+
+var (
+	infoHashRegexp       = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+	magnetInfoHashRegexp = regexp.MustCompile(`(?i)xt=urn:btih:([0-9a-f]{40})`)
+	imdbRegexp           = regexp.MustCompile(`(?:^|tt)(\d{1,8})\b`)
+	numberRegexp         = regexp.MustCompile(`\d+`)
+	bencodeDictRegexp    = regexp.MustCompile(`^d\d+:`)
+)
+
+// resultFields are the search fields that extractItem knows how to map onto a result
+var resultFields = []string{
+	"download", "details", "comments", "title", "description", "category", "size", "leechers",
+	"seeders", "date", "files", "grabs", "downloadvolumefactor", "uploadvolumefactor",
+	"minimumratio", "minimumseedtime", "infohash", "magnet", "imdb", "tvdbid", "tmdbid", "poster",
+	"genre", "year", "author", "booktitle",
+}
+
+// fieldTemplateCtx is the context for fields with a text template, Result has the values of the
+// fields extracted before it in the row
+type fieldTemplateCtx struct {
+	Config map[string]string
+	Query  torznab.Query
+	Result map[string]string
+}
+
+// isHelperField returns whether a field is only extracted for use in other fields' templates
+func isHelperField(field string) bool {
+	return strings.HasPrefix(field, "_")
+}
+
+func (r *Runner) extractItem(rowIdx int, selection searchRow, templateCtx searchTemplateCtx) (extractedItem, error) {
+	ctx := fieldTemplateCtx{
+		Config: templateCtx.Config,
+		Query:  templateCtx.Query,
+		Result: map[string]string{},
+	}
+
+	if h, ok := selection.(htmlRow); ok {
+		html, _ := goquery.OuterHtml(h.Selection)
+		r.logger.WithFields(logrus.Fields{"html": gohtml.Format(html)}).Debug("Processing row")
+	} else {
+		r.logger.WithFields(logrus.Fields{"row": selection.Text()}).Debug("Processing row")
+	}
+
+	row, err := r.extractFields(rowIdx, selection, r.definition.Search.Fields, ctx)
+	if err != nil {
+		return extractedItem{}, err
 	}
 
 	item := extractedItem{
@@ -902,131 +1564,260 @@ func (r *Runner) extractItem(rowIdx int, selection *goquery.Selection) (extracte
 		Debugf("Finished row %d", rowIdx)
 
 	for key, val := range row {
-		switch key {
-		case "download":
-			u, err := r.resolvePath(val)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Link = u
-		case "details":
-			u, err := r.resolvePath(val)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.GUID = u
+		r.setItemField(&item, rowIdx, key, val, r.resolvePath)
+	}
 
-			// comments is used by Sonarr for linking to
-			if item.Comments == "" {
-				item.Comments = u
-			}
-		case "comments":
-			u, err := r.resolvePath(val)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Comments = u
-		case "title":
-			item.Title = val
-		case "description":
-			item.Description = val
-		case "category":
-			item.LocalCategoryID = val
-		case "size":
-			bytes, err := humanize.ParseBytes(strings.Replace(val, ",", "", -1))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable size %q: %v", rowIdx, val, err.Error())
-				continue
-			}
-			r.logger.Debugf("After parsing, size is %v", bytes)
-			item.Size = bytes
-		case "leechers":
-			leechers, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable leechers value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Peers += leechers
-		case "seeders":
-			seeders, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable seeders value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Seeders = seeders
-			item.Peers += seeders
-		case "date":
-			t, err := parseFuzzyTime(val, time.Now())
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable time %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.PublishDate = t
-		case "files":
-			files, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable files value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Files = files
-		case "grabs":
-			grabs, err := strconv.Atoi(normalizeNumber(val))
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable grabs value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.Grabs = grabs
-		case "downloadvolumefactor":
-			downloadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable downloadvolumefactor value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.DownloadVolumeFactor = downloadvolumefactor
-		case "uploadvolumefactor":
-			uploadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable uploadvolumefactor value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.UploadVolumeFactor = uploadvolumefactor
-		case "minimumratio":
-			minimumratio, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable minimumratio value %q in %s", rowIdx, val, key)
-				continue
-			}
-			item.MinimumRatio = minimumratio
-		case "minimumseedtime":
-			minimumseedtime, err := strconv.ParseFloat(normalizeNumber(val), 64)
-			if err != nil {
-				r.logger.Warnf("Row #%d has unparseable minimumseedtime value %q in %s", rowIdx, val, key)
-				continue
+	r.completeItem(&item)
+
+	if h, ok := selection.(htmlRow); ok && r.hasDateHeader() {
+		date, err := r.extractDateHeader(h.Selection)
+		if err != nil {
+			return extractedItem{}, err
+		}
+
+		item.PublishDate = date
+	}
+
+	return item, nil
+}
+
+// extractFields extracts the values of fields from a selection, fields are extracted in order so
+// that text templates can use the fields before them
+func (r *Runner) extractFields(rowIdx int, selection searchRow, fields fieldsListBlock, ctx fieldTemplateCtx) (map[string]string, error) {
+	row := map[string]string{}
+
+	for _, item := range fields {
+		r.logger.
+			WithFields(logrus.Fields{"row": rowIdx, "block": item.Block.String()}).
+			Debugf("Processing field %q", item.Field)
+
+		block := item.Block
+		r.localize(&block)
+
+		var val string
+		var err error
+
+		// fields are extracted in order, so text templates can use the fields before them
+		if strings.Contains(block.TextVal, "{{") {
+			if val, err = r.applyTemplate("field_"+item.Field, block.TextVal, ctx); err == nil {
+				val, err = block.applyFilters(val)
 			}
-			item.MinimumSeedTime = time.Duration(minimumseedtime) * time.Second
-		default:
-			r.logger.Warnf("Row #%d has unknown field %s", rowIdx, key)
+		} else {
+			val, err = selection.MatchText(block)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ctx.Result[item.Field] = val
+
+		r.logger.
+			WithFields(logrus.Fields{"row": rowIdx, "output": val}).
+			Debugf("Finished processing field %q", item.Field)
+
+		// optional fields that didn't match are left unset
+		if item.Block.Optional && val == "" {
 			continue
 		}
-	}
 
-	if item.GUID == "" && item.Link != "" {
-		item.GUID = item.Link
+		if !isHelperField(item.Field) {
+			row[item.Field] = val
+		}
 	}
 
-	if r.hasDateHeader() {
-		date, err := r.extractDateHeader(selection)
+	return row, nil
+}
+
+// setItemField parses a field's value into the item, urls are resolved with resolve
+func (r *Runner) setItemField(item *extractedItem, rowIdx int, key, val string, resolve func(string) (string, error)) {
+	switch key {
+	case "download":
+		u, err := resolve(val)
 		if err != nil {
-			return extractedItem{}, err
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
 		}
+		item.Link = u
+	case "details":
+		u, err := resolve(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.GUID = u
+		item.DetailsURL = u
 
-		item.PublishDate = date
+		// comments is used by Sonarr for linking to
+		if item.Comments == "" {
+			item.Comments = u
+		}
+	case "comments":
+		u, err := resolve(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Comments = u
+	case "title":
+		item.Title = val
+	case "description":
+		item.Description = val
+	case "category":
+		item.LocalCategoryID = val
+	case "size":
+		bytes, err := parseSize(val, r.definition.numberFormat(), r.definition.binarySizes())
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable size %q: %v", rowIdx, val, err.Error())
+			return
+		}
+		r.logger.Debugf("After parsing, size is %v", bytes)
+		item.Size = bytes
+	case "leechers":
+		leechers, err := strconv.Atoi(normalizeNumber(val, r.definition.numberFormat()))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable leechers value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Leechers = leechers
+	case "seeders":
+		seeders, err := strconv.Atoi(normalizeNumber(val, r.definition.numberFormat()))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable seeders value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Seeders = seeders
+	case "date":
+		t, err := parseFuzzyTime(val, time.Now(), r.definition.Location())
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable time %q in %s", rowIdx, val, key)
+			return
+		}
+		item.PublishDate = t
+	case "files":
+		files, err := strconv.Atoi(normalizeNumber(val, r.definition.numberFormat()))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable files value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Files = files
+	case "grabs":
+		grabs, err := strconv.Atoi(normalizeNumber(val, r.definition.numberFormat()))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable grabs value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Grabs = grabs
+	case "downloadvolumefactor":
+		downloadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val, r.definition.numberFormat()), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable downloadvolumefactor value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.DownloadVolumeFactor = downloadvolumefactor
+	case "uploadvolumefactor":
+		uploadvolumefactor, err := strconv.ParseFloat(normalizeNumber(val, r.definition.numberFormat()), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable uploadvolumefactor value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.UploadVolumeFactor = uploadvolumefactor
+	case "minimumratio":
+		minimumratio, err := strconv.ParseFloat(normalizeNumber(val, r.definition.numberFormat()), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable minimumratio value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.MinimumRatio = minimumratio
+	case "minimumseedtime":
+		minimumseedtime, err := strconv.ParseFloat(normalizeNumber(val, r.definition.numberFormat()), 64)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable minimumseedtime value %q in %s", rowIdx, val, key)
+			return
+		}
+		item.MinimumSeedTime = time.Duration(minimumseedtime) * time.Second
+	case "infohash":
+		if !infoHashRegexp.MatchString(val) {
+			r.logger.Warnf("Row #%d has invalid infohash %q in %s", rowIdx, val, key)
+			return
+		}
+		item.InfoHash = strings.ToLower(val)
+	case "magnet":
+		if !strings.HasPrefix(val, "magnet:") {
+			r.logger.Warnf("Row #%d has invalid magnet link %q in %s", rowIdx, val, key)
+			return
+		}
+		item.MagnetURI = val
+	case "imdb":
+		m := imdbRegexp.FindStringSubmatch(val)
+		if m == nil {
+			r.logger.Warnf("Row #%d has unparseable imdb id %q in %s", rowIdx, val, key)
+			return
+		}
+		id, _ := strconv.Atoi(m[1])
+		item.IMDBID = fmt.Sprintf("tt%07d", id)
+	case "tvdbid", "tmdbid", "year":
+		id, err := strconv.Atoi(numberRegexp.FindString(val))
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable %s value %q", rowIdx, key, val)
+			return
+		}
+		switch key {
+		case "tvdbid":
+			item.TVDBID = id
+		case "tmdbid":
+			item.TMDBID = id
+		case "year":
+			item.Year = id
+		}
+	case "poster":
+		u, err := resolve(val)
+		if err != nil {
+			r.logger.Warnf("Row #%d has unparseable url %q in %s", rowIdx, val, key)
+			return
+		}
+		item.Poster = u
+	case "genre":
+		item.Genre = val
+	case "author":
+		item.Author = val
+	case "booktitle":
+		item.BookTitle = val
+	default:
+		r.logger.Warnf("Row #%d has unknown field %s", rowIdx, key)
+		return
 	}
+}
 
-	return item, nil
+// completeItem fills in the links and counts that can be derived from other fields
+func (r *Runner) completeItem(item *extractedItem) {
+	item.Peers = item.Seeders + item.Leechers
+
+	// the download link is extracted from the details page when downloaded
+	if item.Link == "" && item.GUID != "" && !r.definition.Download.IsEmpty() {
+		item.Link = item.GUID
+	}
+
+	// magnets are used for the link when there isn't a torrent to download, and give us an
+	// infohash if the row didn't have one
+	if item.MagnetURI != "" {
+		if item.Link == "" {
+			item.Link = item.MagnetURI
+		}
+		if m := magnetInfoHashRegexp.FindStringSubmatch(item.MagnetURI); m != nil && item.InfoHash == "" {
+			item.InfoHash = strings.ToLower(m[1])
+		}
+	}
+
+	if item.GUID == "" && item.Link != "" {
+		item.GUID = item.Link
+	}
+}
+
+// localize sets the time zone and number format that the filters of a block parse with
+func (r *Runner) localize(block *selectorBlock) {
+	numbers := r.definition.numberFormat()
+	block.location = r.definition.Location()
+	block.numbers = &numbers
 }
 
 func (r *Runner) hasDateHeader() bool {
@@ -1035,6 +1826,7 @@ func (r *Runner) hasDateHeader() bool {
 
 func (r *Runner) extractDateHeader(selection *goquery.Selection) (time.Time, error) {
 	dateHeaders := r.definition.Search.Rows.DateHeaders
+	r.localize(&dateHeaders)
 
 	r.logger.
 		WithFields(logrus.Fields{"selector": dateHeaders.String()}).
@@ -1046,11 +1838,16 @@ func (r *Runner) extractDateHeader(selection *goquery.Selection) (time.Time, err
 	}
 
 	dv, _ := dateHeaders.Text(prev.First())
-	return parseFuzzyTime(dv, time.Now())
+	return parseFuzzyTime(dv, time.Now(), r.definition.Location())
 }
 
 func (r *Runner) Download(u string) (io.ReadCloser, http.Header, error) {
 	r.createBrowser()
+	defer r.releaseBrowser()
+
+	if err := r.applyRequestHeaders(r.definition.Download.Headers); err != nil {
+		return nil, http.Header{}, err
+	}
 
 	if required, err := r.isLoginRequired(); required {
 		if err := r.login(); err != nil {
@@ -1066,22 +1863,147 @@ func (r *Runner) Download(u string) (io.ReadCloser, http.Header, error) {
 		return nil, http.Header{}, err
 	}
 
-	if err := r.browser.Open(fullUrl); err != nil {
+	if !r.definition.Download.Before.IsEmpty() {
+		if err = r.downloadBefore(fullUrl); err != nil {
+			return nil, http.Header{}, err
+		}
+	}
+
+	if !r.definition.Download.IsEmpty() {
+		if fullUrl, err = r.extractDownloadLink(fullUrl); err != nil {
+			return nil, http.Header{}, err
+		}
+	}
+
+	// torrents are sometimes served as text, they mustn't be transcoded like pages are
+	r.charset.SetPassthrough(true)
+	err = r.browser.Open(fullUrl)
+	r.charset.SetPassthrough(false)
+	if err != nil {
 		return nil, http.Header{}, err
 	}
 
-	pipeR, pipeW := io.Pipe()
-	go func() {
-		defer pipeW.Close()
-		defer r.releaseBrowser()
-		n, err := r.browser.Download(pipeW)
-		if err != nil {
-			r.logger.Error(err)
+	var buf bytes.Buffer
+	n, err := r.browser.Download(&buf)
+	if err != nil {
+		return nil, http.Header{}, err
+	}
+
+	r.logger.WithFields(logrus.Fields{"url": fullUrl}).Debugf("Downloaded %d bytes", n)
+
+	if !isTorrent(r.browser.ResponseHeaders(), buf.Bytes()) {
+		return nil, http.Header{}, r.downloadError(fullUrl)
+	}
+
+	return ioutil.NopCloser(&buf), r.browser.ResponseHeaders(), nil
+}
+
+// downloadBefore makes the request in the download before block, templates have the url being
+// downloaded as .DownloadURL and its query as .Query
+func (r *Runner) downloadBefore(downloadURL string) error {
+	before := r.definition.Download.Before
+
+	cfg, err := r.templateConfig()
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return err
+	}
+
+	ctx := struct {
+		Config      map[string]string
+		DownloadURL string
+		Query       url.Values
+	}{
+		cfg,
+		downloadURL,
+		u.Query(),
+	}
+
+	beforePath, err := r.applyTemplate("download_before_path", before.Path, ctx)
+	if err != nil {
+		return err
+	}
+
+	beforeURL, err := r.resolvePath(beforePath)
+	if err != nil {
+		return err
+	}
+
+	vals := map[string]string{}
+	for name, val := range before.Inputs {
+		if vals[name], err = r.applyTemplate("download_before_inputs", val, ctx); err != nil {
+			return err
 		}
-		r.logger.WithFields(logrus.Fields{"url": fullUrl}).Debugf("Downloaded %d bytes", n)
-	}()
+	}
 
-	return pipeR, r.browser.ResponseHeaders(), nil
+	switch before.Method {
+	case "", "get":
+		err = r.requestWithValues(http.MethodGet, beforeURL, vals)
+	case "post":
+		err = r.requestWithValues(http.MethodPost, beforeURL, vals)
+	default:
+		return fmt.Errorf("Unknown download before method %q", before.Method)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.definition.Download.Error.hasError(r.browser)
+}
+
+// isTorrent returns whether a download is a torrent from its content type, or if that isn't
+// specific from whether the body is a bencoded dictionary
+func isTorrent(h http.Header, body []byte) bool {
+	if strings.Contains(h.Get("Content-Type"), "bittorrent") {
+		return true
+	}
+	return bencodeDictRegexp.Match(body)
+}
+
+// downloadError returns an error for a download that wasn't a torrent, with the message from the
+// download error blocks or the page title
+func (r *Runner) downloadError(downloadURL string) error {
+	if err := r.definition.Download.Error.hasError(r.browser); err != nil {
+		return err
+	}
+
+	msg := strings.TrimSpace(r.browser.Title())
+	if msg == "" {
+		msg = r.browser.ResponseHeaders().Get("Content-Type")
+	}
+
+	return fmt.Errorf("Download of %s isn't a torrent: %s", downloadURL, msg)
+}
+
+// extractDownloadLink opens a details page and extracts the download link from it
+func (r *Runner) extractDownloadLink(detailsURL string) (string, error) {
+	if err := r.openPage(detailsURL); err != nil {
+		return "", err
+	}
+
+	block := r.definition.Download.selectorBlock
+	r.localize(&block)
+
+	link, err := block.MatchText(r.browser.Dom())
+	if err != nil {
+		return "", err
+	}
+
+	if link == "" {
+		return "", fmt.Errorf("No download link found on details page %s", detailsURL)
+	} else if strings.HasPrefix(link, "magnet:") {
+		return "", fmt.Errorf("Details page %s has a magnet link which can't be downloaded", detailsURL)
+	}
+
+	r.logger.
+		WithFields(logrus.Fields{"details": detailsURL, "link": link}).
+		Debugf("Found download link on details page")
+
+	return r.resolvePath(link)
 }
 
 func (r *Runner) Ratio() (string, error) {
@@ -1096,6 +2018,10 @@ func (r *Runner) Ratio() (string, error) {
 	r.createBrowser()
 	defer r.releaseBrowser()
 
+	if err := r.applyRequestHeaders(r.definition.Ratio.Headers); err != nil {
+		return "error", err
+	}
+
 	if required, err := r.isLoginRequired(); required {
 		if err := r.login(); err != nil {
 			r.logger.WithError(err).Error("Login failed")
@@ -1105,7 +2031,23 @@ func (r *Runner) Ratio() (string, error) {
 		return "error", err
 	}
 
-	ratioUrl, err := r.resolvePath(r.definition.Ratio.Path)
+	cfg, err := r.templateConfig()
+	if err != nil {
+		return "error", err
+	}
+
+	ctx := struct {
+		Config map[string]string
+	}{
+		cfg,
+	}
+
+	ratioPath, err := r.applyTemplate("ratio_path", r.definition.Ratio.Path, ctx)
+	if err != nil {
+		return "error", err
+	}
+
+	ratioUrl, err := r.resolvePath(ratioPath)
 	if err != nil {
 		return "error", err
 	}
@@ -1,7 +1,12 @@
 package indexer
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -491,3 +496,1667 @@ func TestIndexerDefinitionRunner_Ratio(t *testing.T) {
 		t.Fatalf("Expected ratio of 1.5, got %v", ratio)
 	}
 }
+
+const exampleJSONDefinition = `
+---
+  site: example
+  links:
+    - https://example.org/
+
+  caps:
+    categories:
+      tv: TV
+
+    modes:
+      search: q
+
+  search:
+    path: api/torrents
+    inputs:
+      q: "{{ .Keywords }}"
+    response:
+      type: json
+    rows:
+      selector: data.torrents
+    fields:
+      category:
+        text: tv
+      title:
+        selector: name
+      details:
+        selector: id
+        filters:
+          - name: prepend
+            args: "/torrents/"
+      download:
+        selector: links.download
+      size:
+        selector: size
+      seeders:
+        selector: stats.seeders
+      leechers:
+        selector: stats.leechers
+      downloadvolumefactor:
+        selector: freeleech
+        case:
+          "true": 0
+          "false": 1
+`
+
+const exampleJSONSearchResponse = `{
+  "data": {
+    "torrents": [
+      {
+        "id": 309960,
+        "name": "Llama llama S01E01",
+        "size": 4294967296,
+        "freeleech": true,
+        "links": {"download": "/download/309960.torrent"},
+        "stats": {"seeders": 12, "leechers": 100}
+      }
+    ]
+  }
+}`
+
+func TestIndexerDefinitionRunner_JSONSearch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleJSONDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/api/torrents", func(req *http.Request) (*http.Response, error) {
+		if q := req.URL.Query().Get("q"); q != "llamas" {
+			t.Fatalf("Incorrect query %q was provided", q)
+		}
+		resp := httpmock.NewStringResponse(http.StatusOK, exampleJSONSearchResponse)
+		resp.Header.Set("Content-Type", "application/json")
+		return resp, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	if results[0].Title != "Llama llama S01E01" {
+		t.Fatalf("Incorrect title %q", results[0].Title)
+	}
+
+	if results[0].GUID != "https://example.org/torrents/309960" {
+		t.Fatalf("Incorrect details link %q", results[0].GUID)
+	}
+
+	if results[0].Link != "https://example.org/download/309960.torrent" {
+		t.Fatalf("Incorrect download link %q", results[0].Link)
+	}
+
+	if results[0].Size != 4294967296 {
+		t.Fatalf("Incorrect size %d", results[0].Size)
+	}
+
+	if results[0].Peers != 112 {
+		t.Fatal("Incorrect peers count")
+	}
+
+	if results[0].DownloadVolumeFactor != 0 {
+		t.Fatal("Incorrect download volume factor")
+	}
+}
+
+const examplePagingDefinition = `
+---
+  site: example
+  links:
+    - https://example.org/
+
+  caps:
+    categories:
+      1: TV
+
+    modes:
+      search: q
+
+  search:
+    path: browse.php
+    inputs:
+      q: "{{ .Keywords }}"
+    paging:
+      input: page
+      start: 1
+      maxpages: 3
+    rows:
+      selector: tr
+    fields:
+      category:
+        text: 1
+      title:
+        selector: td:nth-child(1)
+      download:
+        selector: a
+        attribute: href
+`
+
+func TestIndexerDefinitionRunner_PagingSearch(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(examplePagingDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var requested []string
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		page := req.URL.Query().Get("page")
+		requested = append(requested, page)
+
+		body := "<table>"
+		if page != "4" {
+			for i := 1; i <= 2; i++ {
+				body += fmt.Sprintf(`<tr><td>Llama %s-%d</td><td><a href="/%s-%d.torrent">dl</a></td></tr>`, page, i, page, i)
+			}
+		}
+		body += "</table>"
+
+		return httpmock.NewStringResponse(http.StatusOK, body), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	for idx, example := range []struct {
+		query     torznab.Query
+		titles    []string
+		requested []string
+	}{
+		{torznab.Query{Q: "llamas"}, []string{"Llama 1-1", "Llama 1-2", "Llama 2-1", "Llama 2-2", "Llama 3-1", "Llama 3-2"}, []string{"1", "2", "3"}},
+		{torznab.Query{Q: "llamas", Limit: 3}, []string{"Llama 1-1", "Llama 1-2", "Llama 2-1"}, []string{"1", "2"}},
+		{torznab.Query{Q: "llamas", Limit: 2, Offset: 3}, []string{"Llama 2-2", "Llama 3-1"}, []string{"1", "2", "3"}},
+		{torznab.Query{Q: "llamas", Limit: 10}, []string{"Llama 1-1", "Llama 1-2", "Llama 2-1", "Llama 2-2", "Llama 3-1", "Llama 3-2"}, []string{"1", "2", "3"}},
+		{torznab.Query{Q: "llamas", Offset: 10}, []string{}, []string{"1", "2", "3"}},
+	} {
+		requested = []string{}
+
+		results, err := r.Search(example.query)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+
+		titles := []string{}
+		for _, result := range results {
+			titles = append(titles, result.Title)
+		}
+
+		if !reflect.DeepEqual(titles, example.titles) {
+			t.Fatalf("Row #%d was expecting titles %v, got %v", idx+1, example.titles, titles)
+		}
+
+		if !reflect.DeepEqual(requested, example.requested) {
+			t.Fatalf("Row #%d was expecting pages %v to be requested, got %v", idx+1, example.requested, requested)
+		}
+	}
+}
+
+func TestIndexerDefinitionRunner_PagingNextLink(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(examplePagingDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def.Search.Paging = pagingBlock{
+		Next: selectorBlock{Selector: "a.next", Attribute: "href"},
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		body := `<table><tr><td>Llama 1</td><td><a href="/1.torrent">dl</a></td></tr></table>`
+		if req.URL.Query().Get("p") == "" {
+			body += `<a class="next" href="browse.php?p=2">Next</a>`
+		} else {
+			body = `<table><tr><td>Llama 2</td><td><a href="/2.torrent">dl</a></td></tr></table>`
+		}
+		return httpmock.NewStringResponse(http.StatusOK, body), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas", Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results from following the next link, got %d", len(results))
+	}
+}
+
+func TestIndexerDefinitionRunner_PagingRepeated(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(examplePagingDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	var requested []string
+
+	// the page input is ignored, so every page has the same rows
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Query().Get("page"))
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td>Llama 1</td><td><a href="/1.torrent">dl</a></td></tr></table>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected the repeated rows to be returned once, got %d results", len(results))
+	}
+
+	if !reflect.DeepEqual(requested, []string{"1", "2"}) {
+		t.Fatalf("Expected paging to stop after a page with no new results, got pages %v", requested)
+	}
+}
+
+const exampleSearchPathsDefinition = `
+---
+  site: example
+  links:
+    - https://example.org/
+
+  caps:
+    categories:
+      tv: TV
+      movies: Movies
+
+    modes:
+      search: q
+      tv-search: q
+
+  search:
+    method: get
+    inputs:
+      q: "{{ .Keywords }}"
+    paths:
+      - path: tv.php
+        categories: [TV]
+        inputs:
+          type: tv
+      - path: movies.php
+        categories: Movies
+        method: post
+      - path: latest.php
+        modes: [search]
+    rows:
+      selector: tr
+    fields:
+      category:
+        selector: td:nth-child(1)
+      title:
+        selector: td:nth-child(2)
+      details:
+        selector: a
+        attribute: href
+`
+
+func TestIndexerDefinitionRunner_SearchPaths(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleSearchPathsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requested []string
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/tv.php", func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, "tv:"+req.URL.Query().Get("type"))
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td>tv</td><td>Llama S01E01</td><td><a href="/1">1</a></td></tr></table>`), nil
+	})
+
+	registerResponder("POST", "https://example.org/movies.php", func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, "movies:"+req.FormValue("q"))
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td>movies</td><td>Llama Movie</td><td><a href="/2">2</a></td></tr></table>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/latest.php", func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, "latest")
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td>tv</td><td>Llama S01E01</td><td><a href="/1">1</a></td></tr></table>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	for idx, example := range []struct {
+		query     torznab.Query
+		requested []string
+		results   int
+	}{
+		{torznab.Query{Q: "llamas"}, []string{"tv:tv", "movies:llamas", "latest"}, 2},
+		{torznab.Query{Type: "tv-search", Q: "llamas", Categories: []int{torznab.CategoryTV_HD.ID}}, []string{"tv:tv"}, 1},
+		{torznab.Query{Q: "llamas", Categories: []int{torznab.CategoryMovies.ID}}, []string{"movies:llamas", "latest"}, 1},
+	} {
+		requested = []string{}
+
+		results, err := r.Search(example.query)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+
+		if !reflect.DeepEqual(requested, example.requested) {
+			t.Fatalf("Row #%d was expecting paths %v to be requested, got %v", idx+1, example.requested, requested)
+		}
+
+		if len(results) != example.results {
+			t.Fatalf("Row #%d was expecting %d results, got %d", idx+1, example.results, len(results))
+		}
+	}
+}
+
+func TestSearchPathMatchesQuery(t *testing.T) {
+	tvPath := searchPath{Path: "tv.php", Modes: []string{"tv-search"}}
+	moviePath := searchPath{Path: "movies.php", Modes: []string{"movie-search"}}
+
+	for idx, example := range []struct {
+		path     searchPath
+		vals     url.Values
+		expected bool
+	}{
+		{tvPath, url.Values{"t": {"tvsearch"}}, true},
+		{tvPath, url.Values{"t": {"tv-search"}}, true},
+		{tvPath, url.Values{"t": {"movie"}}, false},
+		{moviePath, url.Values{"t": {"movie"}}, true},
+		{moviePath, url.Values{"t": {"moviesearch"}}, true},
+		{moviePath, url.Values{"t": {"search"}}, false},
+		{searchPath{Path: "latest.php", Modes: []string{"search"}}, url.Values{}, true},
+	} {
+		query, err := torznab.ParseQuery(example.vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if match := example.path.matchesQuery(query); match != example.expected {
+			t.Fatalf("Row #%d expected %s to match t=%q to be %v", idx+1, example.path.Path, query.Type, example.expected)
+		}
+	}
+}
+
+const exampleMultiStepLoginDefinition = `
+---
+  site: example
+  name: Example
+  links:
+    - https://example.org/
+
+  login:
+    steps:
+      - path: /login.php
+        method: get
+      - path: /takelogin.php
+        method: post
+        inputs:
+          username: "{{ .Config.username }}"
+          password: "{{ .Config.password }}"
+          csrf: "{{ .Inputs.csrf }}"
+        error:
+          - selector: .error
+      - path: /pin.php
+        method: form
+        form: form#pin
+        inputs:
+          pin: "{{ .Config.pin }}"
+    test:
+      path: /profile.php
+      selector: .username
+
+  search:
+    path: /torrents.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: td
+`
+
+func TestIndexerDefinitionRunner_MultiStepLogin(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleMultiStepLoginDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &config.ArrayConfig{
+		"example": map[string]string{
+			"username": "myusername",
+			"password": "mypassword",
+			"pin":      "1234",
+		},
+	}
+
+	var steps []string
+	var loggedIn bool
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/profile.php", func(req *http.Request) (*http.Response, error) {
+		if !loggedIn {
+			return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `<span class="username">myusername</span>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/login.php", func(req *http.Request) (*http.Response, error) {
+		steps = append(steps, "login")
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<form method="post" action="/takelogin.php"><input type="hidden" name="csrf" value="abc123"></form>`), nil
+	})
+
+	registerResponder("POST", "https://example.org/takelogin.php", func(req *http.Request) (*http.Response, error) {
+		steps = append(steps, "takelogin")
+		if csrf := req.FormValue("csrf"); csrf != "abc123" {
+			return httpmock.NewStringResponse(http.StatusOK, `<div class="error">Invalid token</div>`), nil
+		}
+		if pwd := req.FormValue("password"); pwd != "mypassword" {
+			return httpmock.NewStringResponse(http.StatusOK, `<div class="error">Wrong password</div>`), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/pin.php", func(req *http.Request) (*http.Response, error) {
+		steps = append(steps, "pin")
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<form id="pin" method="post" action="/pin.php"><input type="hidden" name="token" value="xyz"><input name="pin"></form>`), nil
+	})
+
+	registerResponder("POST", "https://example.org/pin.php", func(req *http.Request) (*http.Response, error) {
+		steps = append(steps, "submitpin")
+		if req.FormValue("pin") == "1234" && req.FormValue("token") == "xyz" {
+			loggedIn = true
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{Config: conf, Transport: httpmock.DefaultTransport})
+	if err = r.login(); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"login", "takelogin", "pin", "submitpin"}; !reflect.DeepEqual(steps, expected) {
+		t.Fatalf("Expected login steps %v, got %v", expected, steps)
+	}
+
+	(*conf)["example"]["password"] = "wrongpassword"
+	loggedIn = false
+
+	if err = r.login(); err == nil || err.Error() != "Wrong password" {
+		t.Fatalf("Expected 'Wrong password', got %#v", err)
+	}
+}
+
+const exampleHeaderLoginDefinition = `
+---
+  site: example
+  name: Example
+  links:
+    - https://example.org/
+
+  settings:
+    - name: apikey
+      type: text
+      label: API Key
+
+  login:
+    method: %s
+    inputs:
+      %s: "{{ .Config.apikey }}"
+
+  search:
+    path: /api/torrents
+    inputs:
+      q: "{{ .Keywords }}"
+    headers:
+      Accept: application/json
+      X-Client: "cardigann {{ .Config.apikey | len }}"
+    response:
+      type: json
+    rows:
+      selector: results
+    fields:
+      title:
+        selector: name
+`
+
+func TestIndexerDefinitionRunner_HeaderLogin(t *testing.T) {
+	for idx, example := range []struct {
+		method, input string
+		check         func(req *http.Request) bool
+	}{
+		{"header", "Authorization", func(req *http.Request) bool {
+			return req.Header.Get("Authorization") == "secret"
+		}},
+		{"header", "X-Api-Key", func(req *http.Request) bool {
+			return req.Header.Get("X-Api-Key") == "secret"
+		}},
+		{"apikey", "apikey", func(req *http.Request) bool {
+			return req.URL.Query().Get("apikey") == "secret"
+		}},
+	} {
+		httpmock.Activate()
+
+		def, err := ParseDefinition([]byte(fmt.Sprintf(exampleHeaderLoginDefinition, example.method, example.input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conf := &config.ArrayConfig{
+			"example": map[string]string{
+				"apikey": "secret",
+			},
+		}
+
+		registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+			if !example.check(req) {
+				t.Errorf("Row #%d requested %s without credentials", idx+1, req.URL)
+			}
+			return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+		})
+
+		registerResponder("GET", "https://example.org/api/torrents", func(req *http.Request) (*http.Response, error) {
+			if !example.check(req) || req.URL.Query().Get("q") != "llamas" {
+				return httpmock.NewStringResponse(http.StatusUnauthorized, `{"results": []}`), nil
+			}
+			if req.Header.Get("Accept") != "application/json" || req.Header.Get("X-Client") != "cardigann 6" {
+				return httpmock.NewStringResponse(http.StatusBadRequest, `{"results": []}`), nil
+			}
+			return httpmock.NewStringResponse(http.StatusOK, `{"results": [{"name": "Llamas"}]}`), nil
+		})
+
+		r := NewRunner(def, RunnerOpts{Config: conf, Transport: httpmock.DefaultTransport})
+		results, err := r.Search(torznab.Query{Q: "llamas"})
+		if err == nil {
+			// login on its own, as the tester does
+			err = r.login()
+		}
+		httpmock.DeactivateAndReset()
+
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if len(results) != 1 {
+			t.Fatalf("Row #%d expected 1 result, got %d", idx+1, len(results))
+		}
+	}
+}
+
+func TestHeaderTransportHosts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var received []string
+
+	for _, u := range []string{"https://example.org/download", "https://cdn.example.com/file"} {
+		registerResponder("GET", u, func(req *http.Request) (*http.Response, error) {
+			received = append(received, req.Header.Get("Authorization"))
+			return httpmock.NewStringResponse(http.StatusOK, ""), nil
+		})
+	}
+
+	transport := &headerTransport{
+		RoundTripper: httpmock.DefaultTransport,
+		Hosts:        hostsForLinks("https://example.org/"),
+	}
+	transport.SetHeader("Authorization", "Bearer secret")
+
+	client := &http.Client{Transport: transport}
+	for _, u := range []string{"https://example.org/download", "https://cdn.example.com/file"} {
+		if _, err := client.Get(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expected := []string{"Bearer secret", ""}; !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Expected headers %v, got %v", expected, received)
+	}
+}
+
+const exampleExtraFieldsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: api/torrents
+    response:
+      type: json
+    rows:
+      selector: torrents
+    fields:
+      title:
+        selector: name
+      size:
+        selector: size
+      magnet:
+        selector: magnet
+      imdb:
+        selector: imdb_url
+      tvdbid:
+        selector: tvdb
+      year:
+        selector: year
+      poster:
+        selector: poster
+      genre:
+        selector: genre
+`
+
+const exampleExtraFieldsResponse = `{
+  "torrents": [
+    {
+      "name": "Llama llama S01E01",
+      "size": "4 GB",
+      "magnet": "magnet:?xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567&dn=llamas",
+      "imdb_url": "http://www.imdb.com/title/tt123456/",
+      "tvdb": "https://thetvdb.com/?tab=series&id=81189",
+      "year": "(2016)",
+      "poster": "/posters/309960.jpg",
+      "genre": "Comedy"
+    }
+  ]
+}`
+
+func TestIndexerDefinitionRunner_ExtraFields(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleExtraFieldsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	registerResponder("GET", "https://example.org/api/torrents", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(http.StatusOK, exampleExtraFieldsResponse)
+		resp.Header.Set("Content-Type", "application/json")
+		return resp, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	result := results[0]
+	if !strings.HasPrefix(result.Link, "magnet:") || result.MagnetURI != result.Link {
+		t.Fatalf("Expected the magnet to be used as the link, got %q", result.Link)
+	}
+	if result.InfoHash != "0123456789abcdef0123456789abcdef01234567" {
+		t.Fatalf("Incorrect infohash %q", result.InfoHash)
+	}
+	if result.IMDBID != "tt0123456" {
+		t.Fatalf("Incorrect imdb id %q", result.IMDBID)
+	}
+	if result.TVDBID != 81189 || result.Year != 2016 {
+		t.Fatalf("Incorrect tvdb id %d or year %d", result.TVDBID, result.Year)
+	}
+	if result.Poster != "https://example.org/posters/309960.jpg" || result.Genre != "Comedy" {
+		t.Fatalf("Incorrect poster %q or genre %q", result.Poster, result.Genre)
+	}
+}
+
+const exampleDetailsDownloadDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: browse.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: a
+      details:
+        selector: a
+        attribute: href
+      size:
+        selector: td.size
+
+  download:
+    selector: a.download
+    attribute: href
+`
+
+func TestIndexerDefinitionRunner_DetailsDownload(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDetailsDownloadDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td><a href="details.php?id=1">Llama llama S01E01</a></td><td class="size">4 GB</td></tr></table>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/details.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<html><a class="download" href="download.php/1/llamas.torrent">Download</a></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/download.php/1/llamas.torrent", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(http.StatusOK, "d8:announce")
+		resp.Header.Set("Content-Type", "application/x-bittorrent")
+		return resp, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	if results[0].Link != "https://example.org/details.php?id=1" {
+		t.Fatalf("Expected the details page as the link, got %q", results[0].Link)
+	}
+
+	rc, _, err := r.Download(results[0].Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "d8:announce" {
+		t.Fatalf("Expected the torrent to be downloaded, got %q", b)
+	}
+}
+
+const exampleDownloadBeforeDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: browse.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: a
+
+  download:
+    before:
+      path: thanks.php
+      method: post
+      inputs:
+        torrentid: "{{ .Query.Get \"id\" }}"
+    error:
+      selector: div.error
+`
+
+func TestIndexerDefinitionRunner_DownloadBefore(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDownloadBeforeDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var thanked bool
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("POST", "https://example.org/thanks.php", func(req *http.Request) (*http.Response, error) {
+		thanked = req.FormValue("torrentid") == "1"
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/download.php", func(req *http.Request) (*http.Response, error) {
+		if !thanked {
+			return httpmock.NewStringResponse(http.StatusOK,
+				`<html><title>Download</title><div class="error">Please thank the uploader</div></html>`), nil
+		} else if req.URL.Query().Get("id") == "2" {
+			return httpmock.NewStringResponse(http.StatusOK, `<html><title>Not found</title></html>`), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, "d8:announce"), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	rc, _, err := r.Download("/download.php?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	if !thanked {
+		t.Fatal("Expected the before request to be made")
+	}
+
+	thanked = false
+	registerResponder("POST", "https://example.org/thanks.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	if _, _, err = r.Download("/download.php?id=1"); err == nil || err.Error() != "Please thank the uploader" {
+		t.Fatalf("Expected the page's error message, got %v", err)
+	}
+
+	thanked = true
+	expected := "Download of https://example.org/download.php?id=2 isn't a torrent: Not found"
+	if _, _, err = r.Download("/download.php?id=2"); err == nil || err.Error() != expected {
+		t.Fatalf("Expected %q, got %v", expected, err)
+	}
+}
+
+const exampleSettingsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  settings:
+    - name: freeleech
+      type: checkbox
+      label: Freeleech only
+    - name: sort
+      type: select
+      label: Sort by
+      default: seeders
+      options:
+        date: Date
+        seeders: Seeders
+
+  search:
+    path: browse.php
+    inputs:
+      q: "{{ .Keywords }}"
+      freeleech: "{{ if eq .Config.freeleech \"true\" }}1{{ else }}0{{ end }}"
+      sort: "{{ .Config.sort }}"
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: a
+`
+
+func TestIndexerDefinitionRunner_SearchSettings(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleSettingsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var query url.Values
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		query = req.URL.Query()
+		return httpmock.NewStringResponse(http.StatusOK, `<table></table>`), nil
+	})
+
+	for idx, example := range []struct {
+		config          map[string]string
+		freeleech, sort string
+	}{
+		{map[string]string{}, "0", "seeders"},
+		{map[string]string{"freeleech": "true", "sort": "date"}, "1", "date"},
+	} {
+		r := NewRunner(def, RunnerOpts{
+			Config:    &config.ArrayConfig{"example": example.config},
+			Transport: httpmock.DefaultTransport,
+		})
+
+		if _, err = r.Search(torznab.Query{Q: "llamas"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if query.Get("freeleech") != example.freeleech || query.Get("sort") != example.sort {
+			t.Fatalf("Row #%d expected freeleech=%s and sort=%s, got %v", idx+1, example.freeleech, example.sort, query)
+		}
+	}
+}
+
+func TestSettingsFieldValidate(t *testing.T) {
+	def, err := ParseDefinition([]byte(exampleSettingsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, example := range []struct {
+		setting int
+		value   string
+		valid   bool
+	}{
+		{0, "true", true},
+		{0, "false", true},
+		{0, "yes", false},
+		{1, "date", true},
+		{1, "size", false},
+	} {
+		err := def.Settings[example.setting].Validate(example.value)
+		if (err == nil) != example.valid {
+			t.Fatalf("Row #%d expected %q to be valid=%v, got %v", idx+1, example.value, example.valid, err)
+		}
+	}
+
+	for _, src := range []string{
+		"---\n  site: example\n  settings:\n    - name: sort\n      type: select\n",
+		"---\n  site: example\n  settings:\n    - name: sort\n      type: radio\n",
+		"---\n  site: example\n  settings:\n    - name: fl\n      type: checkbox\n      default: yes\n",
+	} {
+		if _, err := ParseDefinition([]byte(src)); err == nil {
+			t.Fatalf("Expected an error parsing %q", src)
+		}
+	}
+}
+
+const exampleComputedFieldsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  settings:
+    - name: passkey
+      type: text
+      label: Passkey
+
+  search:
+    path: browse.php
+    rows:
+      selector: table tr
+    fields:
+      _name:
+        selector: td.name
+      _year:
+        selector: td.year
+      _id:
+        selector: td.name a
+        attribute: href
+        filters:
+          - name: querystring
+            args: id
+      title:
+        text: "{{ .Result._name }} ({{ .Result._year }}) {{ .Query.Q }}"
+        filters:
+          - name: append
+            args: " [EN]"
+      download:
+        text: "/download.php?id={{ .Result._id }}&passkey={{ .Config.passkey }}"
+`
+
+func TestIndexerDefinitionRunner_ComputedFields(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleComputedFieldsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td class="name"><a href="details.php?id=42">Llama Llama</a></td><td class="year">2016</td></tr></table>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{"example": map[string]string{"passkey": "abc"}},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "1080p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %d", len(results))
+	}
+
+	if results[0].Title != "Llama Llama (2016) 1080p [EN]" {
+		t.Fatalf("Incorrect title %q", results[0].Title)
+	}
+
+	if results[0].Link != "https://example.org/download.php?id=42&passkey=abc" {
+		t.Fatalf("Incorrect download link %q", results[0].Link)
+	}
+}
+
+const exampleDetailsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: browse.php
+    rows:
+      selector: table tr
+    fields:
+      title:
+        selector: a
+      details:
+        selector: a
+        attribute: href
+      comments:
+        text: /forum/
+      seeders:
+        selector: td.seeders
+      leechers:
+        selector: td.leechers
+    details:
+      limit: 2
+      fields:
+        title:
+          selector: h1
+        seeders:
+          selector: span.seeders
+        leechers:
+          selector: span.leechers
+        imdb:
+          selector: a.imdb
+          attribute: href
+        download:
+          selector: a.download
+          attribute: href
+`
+
+func TestIndexerDefinitionRunner_SearchDetails(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleDetailsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<table>
+			<tr><td><a href="/torrents/1/">Llama llama...</a></td><td class="seeders">1</td><td class="leechers">2</td></tr>
+			<tr><td><a href="/torrents/2/">Llama llama...</a></td><td class="seeders">1</td><td class="leechers">2</td></tr>
+			<tr><td><a href="/torrents/3/">Llama llama...</a></td><td class="seeders">1</td><td class="leechers">2</td></tr>
+		</table>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents/1/", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("User-Agent") == "" {
+			t.Error("Expected the details page to be requested with a user agent")
+		}
+		if referer := req.Header.Get("Referer"); referer != "https://example.org/browse.php" {
+			t.Errorf("Expected the details page to be requested with the search page as referer, got %q", referer)
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `<h1>Llama llama S01E01</h1>
+			<span class="seeders">10</span><span class="leechers">20</span>
+			<a class="imdb" href="http://www.imdb.com/title/tt0123456/">IMDb</a>
+			<a class="download" href="download.torrent">Download</a>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents/2/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusNotFound, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/torrents/3/", func(req *http.Request) (*http.Response, error) {
+		t.Error("Expected details pages past the limit not to be fetched")
+		return nil, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	if results[0].Title != "Llama llama S01E01" || results[0].IMDBID != "tt0123456" {
+		t.Fatalf("Expected the first result to have fields from its details page, got %q %q",
+			results[0].Title, results[0].IMDBID)
+	}
+
+	if results[0].Link != "https://example.org/torrents/1/download.torrent" {
+		t.Fatalf("Expected the download link to resolve against the details page, got %q", results[0].Link)
+	}
+
+	if results[0].Seeders != 10 || results[0].Peers != 30 {
+		t.Fatalf("Expected seeders and peers from the details page, got %d and %d",
+			results[0].Seeders, results[0].Peers)
+	}
+
+	for _, result := range results[1:] {
+		if result.Title != "Llama llama..." {
+			t.Fatalf("Expected the result to be unchanged, got %q", result.Title)
+		}
+		if result.Seeders != 1 || result.Peers != 3 {
+			t.Fatalf("Expected seeders and peers from the row, got %d and %d", result.Seeders, result.Peers)
+		}
+	}
+}
+
+const examplePreprocessingDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: browse.php
+    inputs:
+      q: "{{ .Keywords }}"
+    preprocessingfilters:
+      - name: scriptvariable
+        args: torrents
+    noresults:
+      text: No torrents found
+    response:
+      type: json
+    rows:
+      selector: $
+    fields:
+      title:
+        selector: name
+      download:
+        selector: url
+`
+
+func TestIndexerDefinitionRunner_PreprocessingFilters(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(examplePreprocessingDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("q") == "nothing" {
+			return httpmock.NewStringResponse(http.StatusOK, `<html><body><p>No torrents found</p>
+				<script>var torrents = [];</script></body></html>`), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `<html><body><div id="results"></div>
+			<script>
+				var torrents = [
+					{"name": "Llama llama S01E01", "url": "/download/1.torrent"},
+					{"name": "Llama llama S01E02", "url": "/download/2.torrent"}
+				];
+				render(torrents);
+			</script></body></html>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	if results[1].Title != "Llama llama S01E02" || results[1].Link != "https://example.org/download/2.torrent" {
+		t.Fatalf("Incorrect result %q %q", results[1].Title, results[1].Link)
+	}
+
+	// the noresults text is outside of the script that the preprocessing filter extracts
+	results, err = r.Search(torznab.Query{Q: "nothing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 0 {
+		t.Fatalf("Expected no results, got %d", len(results))
+	}
+}
+
+const exampleNoResultsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: search.php
+    inputs:
+      q: "{{ .Query.Keywords }}"
+    noresults:
+      selector: p.empty
+    error:
+      selector: div.error
+    rows:
+      selector: table.results tr
+    fields:
+      title:
+        selector: td a
+      download:
+        selector: td a
+        attribute: href
+`
+
+func TestIndexerDefinitionRunner_NoResults(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleNoResultsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages := map[string]string{
+		"llamas":  `<table class="results"><tr><td><a href="/download/1.torrent">Llama llama S01E01</a></td></tr></table>`,
+		"nothing": `<p class="empty">Nothing found</p><table class="results"></table>`,
+		"limited": `<div class="error">You can only search once every 10 seconds</div>`,
+		"broken":  `<div class="results-v2"><a href="/download/1.torrent">Llama llama S01E01</a></div>`,
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/search.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, "<html><body>"+pages[req.URL.Query().Get("q")]+"</body></html>"), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	for idx, example := range []struct {
+		keywords string
+		results  int
+		errorMsg string
+	}{
+		{"llamas", 1, ""},
+		{"nothing", 0, ""},
+		{"limited", 0, "You can only search once every 10 seconds"},
+		{"broken", 0, `No rows matched "table.results tr" and the page isn't a no results page, the definition appears broken`},
+	} {
+		results, err := r.Search(torznab.Query{Q: example.keywords})
+		if example.errorMsg != "" {
+			if err == nil || err.Error() != example.errorMsg {
+				t.Fatalf("Row #%d expected error %q, got %v", idx+1, example.errorMsg, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("Row #%d search failed: %v", idx+1, err)
+		}
+
+		if len(results) != example.results {
+			t.Fatalf("Row #%d expected %d results, got %d", idx+1, example.results, len(results))
+		}
+	}
+
+	// without a noresults check an empty page is trusted to have no results
+	def.Search.NoResults = noResultsBlock{}
+	def.Search.Error = nil
+
+	for _, keywords := range []string{"nothing", "broken"} {
+		results, err := r.Search(torznab.Query{Q: keywords})
+		if err != nil {
+			t.Fatalf("Search for %q failed: %v", keywords, err)
+		}
+		if len(results) != 0 {
+			t.Fatalf("Search for %q expected no results, got %d", keywords, len(results))
+		}
+	}
+}
+
+const exampleEncodingDefinition = `
+---
+  site: example
+  name: Example Site
+  encoding: windows-1252
+  links:
+    - https://example.org/
+
+  search:
+    path: "search/{{ .Keywords }}"
+    inputs:
+      q: "{{ .Keywords }}"
+    noresults:
+      text: Nothing found
+    rows:
+      selector: tr
+    fields:
+      title:
+        selector: a
+      download:
+        selector: a
+        attribute: href
+`
+
+func TestIndexerDefinitionRunner_Encoding(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleEncodingDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/search/Am%E9lie", func(req *http.Request) (*http.Response, error) {
+		if req.URL.RawQuery != "q=Am%E9lie" {
+			t.Errorf("Expected the query to be encoded as windows-1252, got %q", req.URL.RawQuery)
+		}
+		resp := httpmock.NewBytesResponse(http.StatusOK, []byte("<table><tr><td><a href=\"/am\xe9lie.torrent\">Am\xe9lie</a></td></tr></table>"))
+		resp.Header.Set("Content-Type", "text/html")
+		return resp, nil
+	})
+
+	torrent := []byte("d8:announce9:caf\xe9.orge")
+
+	registerResponder("GET", "https://example.org/am%C3%A9lie.torrent", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewBytesResponse(http.StatusOK, torrent)
+		resp.Header.Set("Content-Type", "text/plain")
+		return resp, nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "Amélie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Title != "Amélie" {
+		t.Fatalf("Expected a result titled Amélie, got %v", results)
+	}
+
+	rc, _, err := r.Download(results[0].Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	body, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != string(torrent) {
+		t.Fatalf("Expected the torrent to be downloaded unchanged, got %q", body)
+	}
+}
+
+const exampleKeywordsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: browse.php
+    inputs:
+      q: "{{ .Keywords }}"
+    keywordsfilters:
+      - name: diacritics
+      - name: nopunctuation
+      - name: episodeformat
+        args: "%dx%02d"
+    keywordsminlength: 3
+    rows:
+      selector: tr
+      filters:
+        - name: andmatch
+    fields:
+      title:
+        selector: a
+      download:
+        selector: a
+        attribute: href
+`
+
+func TestIndexerDefinitionRunner_KeywordsFilters(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleKeywordsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var searched []string
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		searched = append(searched, req.URL.Query().Get("q"))
+		return httpmock.NewStringResponse(http.StatusOK,
+			`<table><tr><td><a href="/1.torrent">Llamas The Show 1x02</a></td></tr></table>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	for idx, example := range []struct {
+		query    torznab.Query
+		searched []string
+		results  int
+	}{
+		{torznab.Query{Q: "Llamás: The Show S01E02"}, []string{"Llamas The Show 1x02"}, 1},
+		{torznab.Query{Q: "ü!"}, []string{}, 0},
+		{torznab.Query{}, []string{""}, 1},
+	} {
+		searched = []string{}
+
+		results, err := r.Search(example.query)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+
+		if !reflect.DeepEqual(searched, example.searched) {
+			t.Fatalf("Row #%d expected searches for %q, got %q", idx+1, example.searched, searched)
+		}
+
+		if len(results) != example.results {
+			t.Fatalf("Row #%d expected %d results, got %d", idx+1, example.results, len(results))
+		}
+	}
+}
+
+const exampleRowsSelectorsDefinition = `
+---
+  site: example
+  name: Example Site
+  links:
+    - https://example.org/
+
+  search:
+    path: browse.php
+    rows:
+      selectors:
+        - table.torrents tr
+        - div.torrents div.row
+    fields:
+      title:
+        selectors:
+          - td a
+          - a.title
+      download:
+        selector: a
+        attribute: href
+`
+
+func TestIndexerDefinitionRunner_RowsSelectors(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	def, err := ParseDefinition([]byte(exampleRowsSelectorsDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registerResponder("GET", "https://example.org/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<html></html>`), nil
+	})
+
+	registerResponder("GET", "https://example.org/browse.php", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `<div class="torrents">
+			<div class="row"><a class="title" href="/1.torrent">Llama llama S01E01</a></div>
+			<div class="row"><a class="title" href="/2.torrent">Llama llama S01E02</a></div>
+		</div>`), nil
+	})
+
+	r := NewRunner(def, RunnerOpts{
+		Config:    &config.ArrayConfig{},
+		Transport: httpmock.DefaultTransport,
+	})
+
+	results, err := r.Search(torznab.Query{Q: "llamas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results from the second rows selector, got %d", len(results))
+	}
+
+	if results[1].Title != "Llama llama S01E02" {
+		t.Fatalf("Incorrect title %q", results[1].Title)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/Sirupsen/logrus"
 	"github.com/yosssi/gohtml"
+	"gopkg.in/yaml.v2"
 )
 
 type filterBlock struct {
@@ -16,30 +18,104 @@ type filterBlock struct {
 }
 
 type selectorBlock struct {
-	Selector  string            `yaml:"selector"`
-	TextVal   string            `yaml:"text"`
-	Attribute string            `yaml:"attribute,omitempty"`
-	Remove    string            `yaml:"remove,omitempty"`
-	Filters   []filterBlock     `yaml:"filters,omitempty"`
-	Case      map[string]string `yaml:"case,omitempty"`
+	Selector  string        `yaml:"selector"`
+	Selectors []string      `yaml:"selectors,omitempty"`
+	TextVal   string        `yaml:"text"`
+	Attribute string        `yaml:"attribute,omitempty"`
+	Remove    string        `yaml:"remove,omitempty"`
+	Filters   []filterBlock `yaml:"filters,omitempty"`
+	Case      caseBlock     `yaml:"case,omitempty"`
+	Optional  bool          `yaml:"optional,omitempty"`
+	Default   string        `yaml:"default,omitempty"`
+
+	// location is the time zone that filters parse dates in
+	location *time.Location
+	// numbers is the format that filters parse numbers with
+	numbers *numberFormat
+}
+
+// selectorList returns the selectors to try in order, selector is tried before selectors
+func (s *selectorBlock) selectorList() []string {
+	if s.Selector == "" {
+		return s.Selectors
+	}
+	return append([]string{s.Selector}, s.Selectors...)
+}
+
+// firstMatching returns the first selector that matches, or the first selector if none do
+func (s *selectorBlock) firstMatching(matches func(selector string) bool) string {
+	selectors := s.selectorList()
+	for _, sel := range selectors {
+		if matches(sel) {
+			return sel
+		}
+	}
+	if len(selectors) > 0 {
+		return selectors[0]
+	}
+	return ""
 }
 
 func (s *selectorBlock) Match(selection *goquery.Selection) bool {
-	return !s.IsEmpty() && (selection.Find(s.Selector).Length() > 0 || s.TextVal != "")
+	if s.IsEmpty() {
+		return false
+	} else if s.TextVal != "" {
+		return true
+	}
+	for _, sel := range s.selectorList() {
+		if selection.Find(sel).Length() > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *selectorBlock) MatchText(from *goquery.Selection) (string, error) {
-	if s.TextVal != "" {
-		return s.TextVal, nil
+	return s.fallback(s.matchText(from))
+}
+
+func (s *selectorBlock) matchText(from *goquery.Selection) (string, error) {
+	if s.TextVal != "" {
+		return s.TextVal, nil
+	}
+	selectors := s.selectorList()
+	if len(selectors) == 0 {
+		return s.Text(from)
 	}
-	if s.Selector != "" {
-		result := from.Find(s.Selector)
-		if result.Length() == 0 {
-			return "", fmt.Errorf("Failed to match selector %q", s.Selector)
+	for _, sel := range selectors {
+		if result := from.Find(sel); result.Length() > 0 {
+			return s.Text(result)
 		}
-		return s.Text(result)
 	}
-	return s.Text(from)
+	if len(selectors) == 1 {
+		return "", noMatchError(fmt.Sprintf("Failed to match selector %q", selectors[0]))
+	}
+	return "", noMatchError(fmt.Sprintf("Failed to match any of selectors %q", selectors))
+}
+
+// noMatchError is returned when a block doesn't match the selection, unlike other errors such as
+// failing filters it can be recovered from with a default or by making the block optional
+type noMatchError string
+
+func (e noMatchError) Error() string {
+	return string(e)
+}
+
+// fallback returns the default for a block that failed to match, or an empty string if the
+// block is optional
+func (s *selectorBlock) fallback(val string, err error) (string, error) {
+	if err == nil {
+		return val, nil
+	}
+
+	if _, ok := err.(noMatchError); ok && (s.Default != "" || s.Optional) {
+		filterLogger.
+			WithFields(logrus.Fields{"error": err, "default": s.Default}).
+			Debugf("Using default value for block")
+		return s.Default, nil
+	}
+
+	return "", err
 }
 
 func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
@@ -51,16 +127,17 @@ func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
 		el.Find(s.Remove).Remove()
 	}
 
-	if s.Case != nil {
+	if len(s.Case) > 0 {
 		filterLogger.
 			WithFields(logrus.Fields{"case": s.Case}).
 			Debugf("Applying case to selection")
-		for pattern, value := range s.Case {
-			if el.Is(pattern) || el.Has(pattern).Length() >= 1 {
-				return s.applyFilters(value)
-			}
+		value, err := s.Case.match(func(pattern string) bool {
+			return el.Is(pattern) || el.Has(pattern).Length() >= 1
+		})
+		if err != nil {
+			return "", err
 		}
-		return "", errors.New("None of the cases match")
+		return s.applyFilters(value)
 	}
 
 	html, _ := goquery.OuterHtml(el)
@@ -73,7 +150,7 @@ func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
 	if s.Attribute != "" {
 		val, exists := el.Attr(s.Attribute)
 		if !exists {
-			return "", fmt.Errorf("Requested attribute %q doesn't exist", s.Attribute)
+			return "", noMatchError(fmt.Sprintf("Requested attribute %q doesn't exist", s.Attribute))
 		}
 		output = val
 	}
@@ -81,14 +158,72 @@ func (s *selectorBlock) Text(el *goquery.Selection) (string, error) {
 	return s.applyFilters(output)
 }
 
+// caseDefault is the case pattern that is used when none of the other cases match
+const caseDefault = "*"
+
+type caseItem struct {
+	Pattern string
+	Value   string
+}
+
+// caseBlock is a list of cases written as a map of pattern to value, the cases are tried in the
+// order they are written in
+type caseBlock []caseItem
+
+func (c *caseBlock) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Unmarshal as a MapSlice to preserve order of cases
+	var cases yaml.MapSlice
+	if err := unmarshal(&cases); err != nil {
+		return errors.New("Failed to unmarshal caseBlock")
+	}
+
+	for _, item := range cases {
+		var value string
+		if item.Value != nil {
+			value = fmt.Sprintf("%v", item.Value)
+		}
+		*c = append(*c, caseItem{
+			Pattern: fmt.Sprintf("%v", item.Key),
+			Value:   value,
+		})
+	}
+
+	return nil
+}
+
+// match returns the value of the first case that matches, or the default case if none do
+func (c caseBlock) match(matches func(pattern string) bool) (string, error) {
+	for _, item := range c {
+		if item.Pattern != caseDefault && matches(item.Pattern) {
+			return item.Value, nil
+		}
+	}
+	for _, item := range c {
+		if item.Pattern == caseDefault {
+			return item.Value, nil
+		}
+	}
+	return "", noMatchError("None of the cases match")
+}
+
 func (s *selectorBlock) applyFilters(val string) (string, error) {
 	for _, f := range s.Filters {
 		filterLogger.
 			WithFields(logrus.Fields{"args": f.Args, "before": val}).
 			Debugf("Applying filter %s", f.Name)
 
+		loc := s.location
+		if loc == nil {
+			loc = time.UTC
+		}
+
+		numbers := englishNumbers
+		if s.numbers != nil {
+			numbers = *s.numbers
+		}
+
 		var err error
-		val, err = invokeFilter(f.Name, f.Args, val)
+		val, err = invokeFilterWithLocale(f.Name, f.Args, val, loc, numbers)
 		if err != nil {
 			return "", err
 		}
@@ -98,13 +233,15 @@ func (s *selectorBlock) applyFilters(val string) (string, error) {
 }
 
 func (s *selectorBlock) IsEmpty() bool {
-	return s.Selector == "" && s.TextVal == ""
+	return s.Selector == "" && len(s.Selectors) == 0 && s.TextVal == ""
 }
 
 func (s *selectorBlock) String() string {
 	switch {
-	case s.Selector != "":
+	case s.Selector != "" && len(s.Selectors) == 0:
 		return fmt.Sprintf("Selector(%s)", s.Selector)
+	case len(s.Selectors) > 0:
+		return fmt.Sprintf("Selectors(%s)", strings.Join(s.selectorList(), ", "))
 	case s.TextVal != "":
 		return fmt.Sprintf("Text(%s)", s.TextVal)
 	default:
@@ -1,6 +1,13 @@
 package indexer
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v2"
+)
 
 func TestSelectorIsEmpty(t *testing.T) {
 	for idx, test := range []struct {
@@ -17,3 +24,156 @@ func TestSelectorIsEmpty(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectorFallback(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<table><tr><td class="name">Llamas</td><td class="seeds">5</td></tr></table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := doc.Find("tr")
+
+	for idx, test := range []struct {
+		block    selectorBlock
+		expected string
+		err      bool
+	}{
+		{selectorBlock{Selector: "td.name"}, "Llamas", false},
+		{selectorBlock{Selector: "td.title"}, "", true},
+		{selectorBlock{Selectors: []string{"td.title", "td.name"}}, "Llamas", false},
+		{selectorBlock{Selector: "td.title", Selectors: []string{"td.seeds", "td.name"}}, "5", false},
+		{selectorBlock{Selectors: []string{"td.title", "td.grabs"}}, "", true},
+		{selectorBlock{Selector: "td.grabs", Default: "0"}, "0", false},
+		{selectorBlock{Selector: "td.grabs", Optional: true}, "", false},
+		{selectorBlock{Selector: "td.seeds", Attribute: "title", Default: "1"}, "1", false},
+		{selectorBlock{Selector: "td.seeds", Default: "1"}, "5", false},
+		{selectorBlock{Selector: "td.name", Default: "0", Filters: []filterBlock{{Name: "regexp", Args: "("}}}, "", true},
+		{selectorBlock{Selector: "td.name", Optional: true, Filters: []filterBlock{{Name: "querystring"}}}, "", true},
+	} {
+		result, err := test.block.MatchText(row)
+		if test.err && err == nil {
+			t.Fatalf("Row #%d expected an error", idx+1)
+		} else if !test.err && err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != test.expected {
+			t.Fatalf("Row #%d expected %q, got %q", idx+1, test.expected, result)
+		}
+	}
+}
+
+func TestSelectorCase(t *testing.T) {
+	var parsed selectorBlock
+	err := yaml.Unmarshal([]byte(`
+selector: td.flags
+case:
+  img.freeleech: 0
+  img[alt]: 0.5
+  "*": 1
+`), &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (caseBlock{{"img.freeleech", "0"}, {"img[alt]", "0.5"}, {"*", "1"}}); !reflect.DeepEqual(parsed.Case, expected) {
+		t.Fatalf("Expected cases in yaml order %v, got %v", expected, parsed.Case)
+	}
+
+	for idx, test := range []struct {
+		html     string
+		cases    caseBlock
+		expected string
+		err      bool
+	}{
+		{`<img class="freeleech" alt="Free">`, parsed.Case, "0", false},
+		{`<img alt="Half">`, parsed.Case, "0.5", false},
+		{`<span></span>`, parsed.Case, "1", false},
+		{`<span></span>`, caseBlock{{"*", "1"}, {"span", "2"}}, "2", false},
+		{`<span></span>`, parsed.Case[:2], "", true},
+	} {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+			`<table><tr><td class="flags">` + test.html + `</td></tr></table>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// evaluated repeatedly as map ordering used to make this flip between runs
+		for i := 0; i < 10; i++ {
+			block := selectorBlock{Selector: "td.flags", Case: test.cases}
+			result, err := block.MatchText(doc.Find("tr"))
+			if test.err && err == nil {
+				t.Fatalf("Row #%d expected an error", idx+1)
+			} else if !test.err && err != nil {
+				t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+			}
+			if result != test.expected {
+				t.Fatalf("Row #%d expected %q, got %q", idx+1, test.expected, result)
+			}
+		}
+	}
+}
+
+func TestSelectorFilterNumberFormat(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<table><tr><td class="size">1,234 Go</td></tr></table>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numbers := europeanNumbers
+	for idx, test := range []struct {
+		numbers  *numberFormat
+		expected string
+	}{
+		{nil, "1234 GB"},
+		{&numbers, "1.234 GB"},
+	} {
+		block := selectorBlock{Selector: "td.size", Filters: []filterBlock{{Name: "fuzzysize"}}, numbers: test.numbers}
+		result, err := block.MatchText(doc.Find("tr"))
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != test.expected {
+			t.Fatalf("Row #%d expected %q, got %q", idx+1, test.expected, result)
+		}
+	}
+}
+
+func TestBuiltinDefinitionSiteWideCase(t *testing.T) {
+	def, err := escLoader{Dir(false, "")}.Load("orpheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var block selectorBlock
+	for _, item := range def.Search.Fields {
+		if item.Field == "downloadvolumefactor" {
+			block = item.Block
+		}
+	}
+
+	for idx, test := range []struct {
+		banner   string
+		expected string
+	}{
+		{`<div class="alertbar">Sitewide Freeleech is active!</div>`, "0"},
+		{`<div class="alertbar">You have 1 new message</div>`, "1"},
+		{``, "1"},
+	} {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>` + test.banner +
+			`<table id="torrent_table"><tbody><tr class="torrent"><td class="cats_col"></td></tr></tbody></table>` +
+			`</body></html>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := block.MatchText(doc.Find(def.Search.Rows.Selector))
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != test.expected {
+			t.Fatalf("Row #%d expected %q, got %q", idx+1, test.expected, result)
+		}
+	}
+}
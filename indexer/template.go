@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// templateFuncs are the functions available in definition templates:
+//
+//	replace s old new n       strings.Replace
+//	urlencode s               query escapes s, e.g {{ .Keywords | urlencode }}
+//	join sep list             joins a list of strings, e.g {{ join "," .Categories }}
+//	lower s, upper s          changes the case of s
+//	trim s                    removes leading and trailing whitespace
+//	re_replace pattern repl s replaces regexp matches, repl can refer to groups as ${1}
+//	default def val           returns def if val is empty
+//	now                       the current time
+//	date layout t             formats a time with a go reference layout
+//	padleft width pad s       pads s on the left with pad until it is width long
+var templateFuncs = template.FuncMap{
+	"replace":    strings.Replace,
+	"urlencode":  url.QueryEscape,
+	"join":       templateJoin,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"re_replace": templateReReplace,
+	"default":    templateDefault,
+	"now":        time.Now,
+	"date":       templateDate,
+	"padleft":    templatePadLeft,
+}
+
+func templateJoin(sep string, list interface{}) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join requires a list, got %T", list)
+	}
+
+	items := []string{}
+	for i := 0; i < v.Len(); i++ {
+		items = append(items, fmt.Sprint(v.Index(i).Interface()))
+	}
+	return strings.Join(items, sep), nil
+}
+
+func templateReReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+func templateDefault(def interface{}, val interface{}) interface{} {
+	if val == nil {
+		return def
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	}
+	return val
+}
+
+func templateDate(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+func templatePadLeft(width int, pad string, s interface{}) string {
+	str := fmt.Sprint(s)
+	if pad == "" {
+		return str
+	}
+	for utf8.RuneCountInString(str) < width {
+		str = pad + str
+	}
+	return str
+}
@@ -0,0 +1,50 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cardigann/cardigann/torznab"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	r := NewRunner(&IndexerDefinition{Site: "example"}, RunnerOpts{})
+
+	ctx := struct {
+		Query      torznab.Query
+		Keywords   string
+		Categories []string
+		Config     map[string]string
+		Time       time.Time
+	}{
+		Query:      torznab.Query{Season: "1", Ep: "2"},
+		Keywords:   "Llama & Alpaca S01E02",
+		Categories: []string{"1", "2"},
+		Config:     map[string]string{"apikey": "abc"},
+		Time:       time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC),
+	}
+
+	for idx, example := range []struct {
+		tpl, expected string
+	}{
+		{`{{ .Keywords | urlencode }}`, "Llama+%26+Alpaca+S01E02"},
+		{`{{ join "," .Categories }}`, "1,2"},
+		{`{{ .Keywords | lower }}`, "llama & alpaca s01e02"},
+		{`{{ .Keywords | upper }}`, "LLAMA & ALPACA S01E02"},
+		{`{{ "  llamas " | trim }}`, "llamas"},
+		{`{{ .Keywords | re_replace "S(\\d+)E(\\d+)" "${1}x${2}" }}`, "Llama & Alpaca 01x02"},
+		{`{{ .Config.sort | default "seeders" }}`, "seeders"},
+		{`{{ .Config.apikey | default "none" }}`, "abc"},
+		{`{{ .Time | date "2006-01-02" }}`, "2009-11-10"},
+		{`{{ .Query.Season | padleft 2 "0" }}x{{ .Query.Ep | padleft 3 "0" }}`, "01x002"},
+		{`{{ replace .Keywords " " "." -1 }}`, "Llama.&.Alpaca.S01E02"},
+	} {
+		result, err := r.applyTemplate("test", example.tpl, ctx)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var (
+	namespacedNameRegexp = regexp.MustCompile(`([A-Za-z_][\w.-]*):([A-Za-z_][\w.-]*)`)
+
+	// pseudo-classes supported by cascadia, anything else after a colon is a namespaced element
+	pseudoClasses = map[string]bool{
+		"not": true, "has": true, "haschild": true, "contains": true, "containsown": true,
+		"matches": true, "matchesown": true, "nth-child": true, "nth-last-child": true,
+		"nth-of-type": true, "nth-last-of-type": true, "first-child": true, "last-child": true,
+		"first-of-type": true, "last-of-type": true, "only-child": true, "only-of-type": true,
+		"input": true, "empty": true,
+	}
+)
+
+// xmlName returns the name used for an xml element or attribute in the parsed document, names
+// are lowercased to match css selectors and namespaces are included as a prefix
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return strings.ToLower(n.Space + ":" + n.Local)
+	}
+	return strings.ToLower(n.Local)
+}
+
+// xmlSelector escapes namespaced element names like torrent:infoHash in a css selector
+func xmlSelector(selector string) string {
+	var b bytes.Buffer
+	var quote rune
+	var chunk bytes.Buffer
+
+	flush := func() {
+		b.WriteString(namespacedNameRegexp.ReplaceAllStringFunc(chunk.String(), func(m string) string {
+			parts := strings.SplitN(m, ":", 2)
+			if pseudoClasses[strings.ToLower(parts[1])] {
+				return m
+			}
+			return parts[0] + `\:` + parts[1]
+		}))
+		chunk.Reset()
+	}
+
+	for _, r := range selector {
+		switch {
+		case quote != 0:
+			b.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			flush()
+			b.WriteRune(r)
+			quote = r
+		default:
+			chunk.WriteRune(r)
+		}
+	}
+
+	flush()
+	return b.String()
+}
+
+// parseXMLDocument parses an xml document into a dom that can be queried with css selectors
+func parseXMLDocument(body []byte) (*goquery.Document, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	// the body has already been transcoded to utf-8 by the charsetTransport
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	root := &html.Node{Type: html.DocumentNode}
+	stack := []*html.Node{root}
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to parse xml response: %v", err)
+		}
+
+		parent := stack[len(stack)-1]
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &html.Node{Type: html.ElementNode, Data: xmlName(t.Name)}
+			for _, attr := range t.Attr {
+				el.Attr = append(el.Attr, html.Attribute{Key: xmlName(attr.Name), Val: attr.Value})
+			}
+			parent.AppendChild(el)
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.AppendChild(&html.Node{Type: html.TextNode, Data: string(t)})
+		}
+	}
+
+	return goquery.NewDocumentFromNode(root), nil
+}
+
+// xmlRow is a row from an xml document, selectors are rewritten to support namespaced elements
+type xmlRow struct {
+	htmlRow
+}
+
+func (r xmlRow) MatchText(block selectorBlock) (string, error) {
+	block.Selector = xmlSelector(block.Selector)
+	block.Remove = xmlSelector(block.Remove)
+	block.Attribute = strings.ToLower(block.Attribute)
+
+	selectors := []string{}
+	for _, sel := range block.Selectors {
+		selectors = append(selectors, xmlSelector(sel))
+	}
+	block.Selectors = selectors
+
+	if len(block.Case) > 0 {
+		cases := caseBlock{}
+		for _, c := range block.Case {
+			if c.Pattern != caseDefault {
+				c.Pattern = xmlSelector(c.Pattern)
+			}
+			cases = append(cases, c)
+		}
+		block.Case = cases
+	}
+
+	return r.htmlRow.MatchText(block)
+}
+
+func (r xmlRow) Clone() searchRow {
+	return xmlRow{htmlRow{r.Selection.Clone()}}
+}
+
+// parseXMLRows parses an xml document and returns the elements that match the rows selector
+func parseXMLRows(body []byte, rows rowsBlock) ([]searchRow, error) {
+	doc, err := parseXMLDocument(body)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := rows.firstMatching(func(sel string) bool {
+		return doc.Find(xmlSelector(sel)).Length() > 0
+	})
+
+	matching := doc.Find(xmlSelector(selector))
+	if rows.Remove != "" {
+		matching = matching.Not(xmlSelector(rows.Remove))
+	}
+
+	result := []searchRow{}
+	matching.Each(func(i int, s *goquery.Selection) {
+		result = append(result, xmlRow{htmlRow{s}})
+	})
+
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package indexer
+
+import "testing"
+
+const exampleRSSResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+  <channel>
+    <title>Example</title>
+    <link>https://example.org/</link>
+    <item>
+      <title>Llama llama S01E01</title>
+      <link>https://example.org/download/1.torrent</link>
+      <description><![CDATA[<b>Freeleech</b> &amp; more]]></description>
+      <enclosure url="https://example.org/download/1.torrent" length="4294967296" type="application/x-bittorrent" />
+      <torrent:infoHash>ABCDEF0123456789</torrent:infoHash>
+      <torznab:attr name="seeders" value="12" />
+      <torznab:attr name="peers" value="112" />
+    </item>
+    <item>
+      <title>Llama llama S01E02</title>
+      <link>https://example.org/download/2.torrent</link>
+      <enclosure url="https://example.org/download/2.torrent" length="1024" type="application/x-bittorrent" />
+      <torrent:infoHash>0123456789ABCDEF</torrent:infoHash>
+      <torznab:attr name="seeders" value="3" />
+    </item>
+  </channel>
+</rss>
+`
+
+func TestXMLSelector(t *testing.T) {
+	for idx, example := range []struct {
+		selector, expected string
+	}{
+		{"channel > item", "channel > item"},
+		{"torrent:infoHash", `torrent\:infoHash`},
+		{"item:nth-child(2) torznab:attr[name=seeders]", `item:nth-child(2) torznab\:attr[name=seeders]`},
+		{`link[href="urn:btih"]`, `link[href="urn:btih"]`},
+		{"item:has(torrent:infoHash)", `item:has(torrent\:infoHash)`},
+	} {
+		if result := xmlSelector(example.selector); result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+}
+
+func TestParseXMLRows(t *testing.T) {
+	rows, err := parseXMLRows([]byte(exampleRSSResponse), rowsBlock{
+		selectorBlock: selectorBlock{Selector: "channel > item"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	for idx, example := range []struct {
+		block    selectorBlock
+		expected string
+	}{
+		{selectorBlock{Selector: "title"}, "Llama llama S01E01"},
+		{selectorBlock{Selector: "link"}, "https://example.org/download/1.torrent"},
+		{selectorBlock{Selector: "description"}, "<b>Freeleech</b> &amp; more"},
+		{selectorBlock{Selector: "enclosure", Attribute: "length"}, "4294967296"},
+		{selectorBlock{Selector: "torrent:infoHash"}, "ABCDEF0123456789"},
+		{selectorBlock{Selector: "torznab:attr[name=seeders]", Attribute: "value"}, "12"},
+		{selectorBlock{Selector: "enclosure", Attribute: "URL"}, "https://example.org/download/1.torrent"},
+	} {
+		result, err := rows[0].MatchText(example.block)
+		if err != nil {
+			t.Fatalf("Row #%d had an unexpected error: %s", idx+1, err.Error())
+		}
+		if result != example.expected {
+			t.Fatalf("Row #%d was expecting %q, got %q", idx+1, example.expected, result)
+		}
+	}
+
+	rows, err = parseXMLRows([]byte(exampleRSSResponse), rowsBlock{
+		selectorBlock: selectorBlock{Selector: "item"},
+		Remove:        ":not(:has(torznab:attr[name=peers]))",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 {
+		t.Fatalf("Expected remove to leave 1 row, got %d", len(rows))
+	}
+}
@@ -63,6 +63,7 @@ func run(args []string, exit func(code int)) {
 	configureServiceCommand(app)
 	configureUpdateCommand(app)
 	configureRatiosCommand(app)
+	configureLintCommand(app)
 
 	kingpin.MustParse(app.Parse(args))
 }
@@ -560,3 +561,47 @@ func runRatiosCommand() error {
 
 	return nil
 }
+
+func configureLintCommand(app *kingpin.Application) {
+	var files []string
+
+	cmd := app.Command("lint", "Check yaml indexer definition files for errors without running them")
+
+	cmd.Arg("files", "The definition yaml files").
+		Required().
+		ExistingFilesVar(&files)
+
+	configureGlobalFlags(cmd)
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		applyGlobalFlags()
+		return lintCommand(files)
+	})
+}
+
+func lintCommand(files []string) error {
+	var failed int
+
+	for _, f := range files {
+		errs, err := indexer.LintDefinitionFile(f)
+		if err != nil {
+			return err
+		}
+
+		for _, lintErr := range errs {
+			line := lintErr.Line
+			lintErr.Line = 0
+			fmt.Printf("%s:%d: %s\n", f, line, lintErr)
+		}
+
+		if len(errs) > 0 {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d definition(s) failed linting", failed, len(files))
+	}
+
+	fmt.Printf("→ %d definition(s) passed linting\n", len(files))
+	return nil
+}
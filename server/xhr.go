@@ -21,8 +21,15 @@ type indexerFeedsView struct {
 }
 
 type indexerSettingsView struct {
-	Name  string `json:"name"`
-	Type  string `json:"type"`
+	Name    string                      `json:"name"`
+	Type    string                      `json:"type"`
+	Label   string                      `json:"label"`
+	Options []indexerSettingsOptionView `json:"options,omitempty"`
+	Default string                      `json:"default,omitempty"`
+}
+
+type indexerSettingsOptionView struct {
+	Value string `json:"value"`
 	Label string `json:"label"`
 }
 
@@ -78,10 +85,17 @@ func (h *handler) loadIndexerViews(baseURL string) ([]indexerView, error) {
 		settings := []indexerSettingsView{}
 
 		for _, setting := range def.Settings {
+			options := []indexerSettingsOptionView{}
+			for _, o := range setting.Options {
+				options = append(options, indexerSettingsOptionView{Value: o.Value, Label: o.Label})
+			}
+
 			settings = append(settings, indexerSettingsView{
-				Name:  setting.Name,
-				Label: setting.Label,
-				Type:  setting.Type,
+				Name:    setting.Name,
+				Label:   setting.Label,
+				Type:    setting.Type,
+				Options: options,
+				Default: setting.DefaultValue(),
 			})
 		}
 
@@ -202,6 +216,21 @@ func (h *handler) patchIndexersConfigHandler(w http.ResponseWriter, r *http.Requ
 	}
 	defer r.Body.Close()
 
+	def, err := indexer.DefaultDefinitionLoader.Load(indexerID)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	for _, setting := range def.Settings {
+		if v, ok := req[setting.Name]; ok {
+			if err := setting.Validate(v); err != nil {
+				jsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	for k, v := range req {
 		if err := h.Params.Config.Set(indexerID, k, v); err != nil {
 			jsonError(w, err.Error(), http.StatusInternalServerError)
@@ -45,6 +45,7 @@ func Output(w http.ResponseWriter, items []torznab.ResultItem) {
 			TorrentID:   item.GUID,
 			DetailsURL:  item.Comments,
 			DownloadURL: item.Link,
+			ImdbID:      item.IMDBID,
 			Type:        "movie",
 			Size:        int(item.Size / 1024 / 1024),
 			Leechers:    item.Peers - item.Seeders,
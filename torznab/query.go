@@ -39,6 +39,20 @@ func (query Query) Episode() (s string) {
 	return s
 }
 
+// Mode returns the search mode of the query, the aliases that clients send for t are normalized
+// to the mode keys used in capabilities
+func (query Query) Mode() string {
+	switch query.Type {
+	case "", "search":
+		return "search"
+	case "tvsearch", "tv-search":
+		return "tv-search"
+	case "movie", "moviesearch", "movie-search":
+		return "movie-search"
+	}
+	return query.Type
+}
+
 // Keywords returns the query formatted as search keywords
 func (query Query) Keywords() string {
 	tokens := []string{}
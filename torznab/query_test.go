@@ -39,3 +39,22 @@ func TestQueryEncode(t *testing.T) {
 		}
 	}
 }
+
+func TestQueryMode(t *testing.T) {
+	for idx, row := range []struct {
+		Type, Expected string
+	}{
+		{"", "search"},
+		{"search", "search"},
+		{"tvsearch", "tv-search"},
+		{"tv-search", "tv-search"},
+		{"movie", "movie-search"},
+		{"moviesearch", "movie-search"},
+		{"movie-search", "movie-search"},
+		{"music", "music"},
+	} {
+		if mode := (Query{Type: row.Type}).Mode(); mode != row.Expected {
+			t.Fatalf("Row %d: Expected mode %q for t=%q, got %q", idx+1, row.Expected, row.Type, mode)
+		}
+	}
+}
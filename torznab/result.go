@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -28,6 +29,50 @@ type ResultItem struct {
 	MinimumSeedTime      time.Duration
 	DownloadVolumeFactor float64
 	UploadVolumeFactor   float64
+
+	InfoHash  string
+	MagnetURI string
+	IMDBID    string
+	TVDBID    int
+	TMDBID    int
+	Poster    string
+	Genre     string
+	Year      int
+	Author    string
+	BookTitle string
+}
+
+// extraAttrs returns torznab attrs for the optional fields that are set
+func (ri ResultItem) extraAttrs() []torznabAttrView {
+	attrs := []torznabAttrView{}
+
+	add := func(name, value string) {
+		if value != "" {
+			attrs = append(attrs, torznabAttrView{Name: name, Value: value})
+		}
+	}
+
+	addInt := func(name string, value int) {
+		if value != 0 {
+			add(name, strconv.Itoa(value))
+		}
+	}
+
+	add("infohash", ri.InfoHash)
+	add("magneturl", ri.MagnetURI)
+	if ri.IMDBID != "" {
+		add("imdb", strings.TrimPrefix(ri.IMDBID, "tt"))
+		add("imdbid", ri.IMDBID)
+	}
+	addInt("tvdbid", ri.TVDBID)
+	addInt("tmdbid", ri.TMDBID)
+	add("coverurl", ri.Poster)
+	add("genre", ri.Genre)
+	addInt("year", ri.Year)
+	add("author", ri.Author)
+	add("booktitle", ri.BookTitle)
+
+	return attrs
 }
 
 func (ri ResultItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
@@ -81,6 +126,8 @@ func (ri ResultItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 		},
 	}
 
+	itemView.Attrs = append(itemView.Attrs, ri.extraAttrs()...)
+
 	e.Encode(itemView)
 	return nil
 }
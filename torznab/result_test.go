@@ -0,0 +1,40 @@
+package torznab
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestResultItemExtraAttrs(t *testing.T) {
+	item := ResultItem{
+		Title:    "The Llama Show S01E01",
+		InfoHash: "0123456789abcdef0123456789abcdef01234567",
+		IMDBID:   "tt0123456",
+		TVDBID:   81189,
+		Year:     2016,
+	}
+
+	b, err := xml.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, attr := range []string{
+		`<torznab:attr name="infohash" value="0123456789abcdef0123456789abcdef01234567"></torznab:attr>`,
+		`<torznab:attr name="imdb" value="0123456"></torznab:attr>`,
+		`<torznab:attr name="imdbid" value="tt0123456"></torznab:attr>`,
+		`<torznab:attr name="tvdbid" value="81189"></torznab:attr>`,
+		`<torznab:attr name="year" value="2016"></torznab:attr>`,
+	} {
+		if !strings.Contains(string(b), attr) {
+			t.Fatalf("Expected %s in %s", attr, b)
+		}
+	}
+
+	for _, name := range []string{"magneturl", "tmdbid", "coverurl", "genre", "author", "booktitle"} {
+		if strings.Contains(string(b), `name="`+name+`"`) {
+			t.Fatalf("Expected no %s attr for an unset field in %s", name, b)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 import React, { Component } from 'react';
 import ReactDOM from 'react-dom';
-import { Col, Modal, Button, Form, FormGroup, FormControl, ControlLabel }  from 'react-bootstrap';
+import { Col, Modal, Button, Checkbox, Form, FormGroup, FormControl, ControlLabel }  from 'react-bootstrap';
 
 class ConfigForm extends Component {
   state = {
@@ -9,21 +9,41 @@ class ConfigForm extends Component {
   getValues = () => {
     let values = {};
     Object.keys(this.refs).forEach((ref) => {
-      values[ref] = ReactDOM.findDOMNode(this.refs[ref]).value
+      let node = ReactDOM.findDOMNode(this.refs[ref]);
+      let checkbox = node.querySelector('input[type="checkbox"]');
+      if (checkbox) {
+        values[ref] = checkbox.checked ? "true" : "false";
+      } else {
+        values[ref] = node.value;
+      }
     });
     return values;
   }
+  renderControl = (field) => {
+    switch (field.type) {
+      case "checkbox":
+        return <Checkbox defaultChecked={(field.value || field.default) === "true"} ref={field.name} />;
+      case "select":
+        return (
+          <FormControl componentClass="select" defaultValue={field.value || field.default} ref={field.name}>
+            {field.options.map((o) => <option key={o.value} value={o.value}>{o.label}</option>)}
+          </FormControl>
+        );
+      default:
+        return <FormControl
+          type={field.type}
+          placeholder={field.placeholder}
+          defaultValue={field.value}
+          ref={field.name} />;
+    }
+  }
   render() {
     let fields = this.props.fields.map((field) => {
       return (
         <FormGroup controlId={"formHorizontal" + field.name} key={field.name}>
           <Col componentClass={ControlLabel} sm={2}>{field.label}</Col>
             <Col sm={10}>
-              <FormControl
-                type={field.type}
-                placeholder={field.placeholder}
-                defaultValue={field.value}
-                ref={field.name} />
+              {this.renderControl(field)}
           </Col>
         </FormGroup>
       );